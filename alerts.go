@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Alert posts a message to Slack, Discord or a plain webhook when startup
+// fails, a background process keeps crashing or cleanup completes. Events
+// picks some of startup_failed, gave_up and cleanup, all by default. The
+// URL is expanded from the environment, so it can be kept out of the
+// config.
+type Alert struct {
+	Type   string   `json:"type"`
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+}
+
+var alertEvents = []string{"startup_failed", "gave_up", "cleanup"}
+
+func checkAlerts(alerts []Alert) error {
+	for _, a := range alerts {
+		switch a.Type {
+		case "slack", "discord", "webhook":
+		default:
+			return fmt.Errorf("unknown alert type %q, use slack, discord or webhook", a.Type)
+		}
+		if a.URL == "" {
+			return fmt.Errorf("%s alert needs a url", a.Type)
+		}
+		for _, event := range a.Events {
+			if !containsString(alertEvents, event) {
+				return fmt.Errorf("unknown alert event %q, use startup_failed, gave_up or cleanup", event)
+			}
+		}
+	}
+	return nil
+}
+
+// sendAlert posts to every alert that wants event, and returns once all
+// of them are done.
+func sendAlert(event, title, message string) {
+	wg := sync.WaitGroup{}
+	for _, a := range config().Alerts {
+		if len(a.Events) > 0 && !containsString(a.Events, event) {
+			continue
+		}
+		wg.Add(1)
+		go func(a Alert) {
+			defer wg.Done()
+			err := a.post(event, title, message)
+			if err != nil {
+				logError("ERR: %s alert, %s", a.Type, err)
+			}
+		}(a)
+	}
+	wg.Wait()
+}
+
+func (a Alert) post(event, title, message string) error {
+	host, _ := os.Hostname()
+	var payload interface{}
+	switch a.Type {
+	case "slack":
+		payload = map[string]string{"text": fmt.Sprintf("*%s* on %s\n%s", title, host, message)}
+	case "discord":
+		payload = map[string]string{"content": fmt.Sprintf("**%s** on %s\n%s", title, host, message)}
+	default:
+		payload = map[string]string{
+			"event":   event,
+			"title":   title,
+			"message": message,
+			"host":    host,
+			"time":    time.Now().Format(time.RFC3339),
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(os.ExpandEnv(a.URL), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
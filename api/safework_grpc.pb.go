@@ -0,0 +1,256 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: safework.proto
+
+package api
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	SafeWork_RunTask_FullMethodName    = "/safework.SafeWork/RunTask"
+	SafeWork_Status_FullMethodName     = "/safework.SafeWork/Status"
+	SafeWork_StreamLogs_FullMethodName = "/safework.SafeWork/StreamLogs"
+	SafeWork_Cleanup_FullMethodName    = "/safework.SafeWork/Cleanup"
+)
+
+// SafeWorkClient is the client API for SafeWork service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SafeWorkClient interface {
+	// RunTask runs a named task group and waits for it to finish.
+	RunTask(ctx context.Context, in *RunTaskRequest, opts ...grpc.CallOption) (*Report, error)
+	// Status reports the last startup, task runs and managed processes.
+	Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusReply, error)
+	// StreamLogs streams console output lines until the client cancels.
+	StreamLogs(ctx context.Context, in *StreamLogsRequest, opts ...grpc.CallOption) (SafeWork_StreamLogsClient, error)
+	// Cleanup runs the cleanup commands, and exits the instance if asked.
+	Cleanup(ctx context.Context, in *CleanupRequest, opts ...grpc.CallOption) (*CleanupReply, error)
+}
+
+type safeWorkClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSafeWorkClient(cc grpc.ClientConnInterface) SafeWorkClient {
+	return &safeWorkClient{cc}
+}
+
+func (c *safeWorkClient) RunTask(ctx context.Context, in *RunTaskRequest, opts ...grpc.CallOption) (*Report, error) {
+	out := new(Report)
+	err := c.cc.Invoke(ctx, SafeWork_RunTask_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *safeWorkClient) Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusReply, error) {
+	out := new(StatusReply)
+	err := c.cc.Invoke(ctx, SafeWork_Status_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *safeWorkClient) StreamLogs(ctx context.Context, in *StreamLogsRequest, opts ...grpc.CallOption) (SafeWork_StreamLogsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &SafeWork_ServiceDesc.Streams[0], SafeWork_StreamLogs_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &safeWorkStreamLogsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type SafeWork_StreamLogsClient interface {
+	Recv() (*LogLine, error)
+	grpc.ClientStream
+}
+
+type safeWorkStreamLogsClient struct {
+	grpc.ClientStream
+}
+
+func (x *safeWorkStreamLogsClient) Recv() (*LogLine, error) {
+	m := new(LogLine)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *safeWorkClient) Cleanup(ctx context.Context, in *CleanupRequest, opts ...grpc.CallOption) (*CleanupReply, error) {
+	out := new(CleanupReply)
+	err := c.cc.Invoke(ctx, SafeWork_Cleanup_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SafeWorkServer is the server API for SafeWork service.
+// All implementations must embed UnimplementedSafeWorkServer
+// for forward compatibility
+type SafeWorkServer interface {
+	// RunTask runs a named task group and waits for it to finish.
+	RunTask(context.Context, *RunTaskRequest) (*Report, error)
+	// Status reports the last startup, task runs and managed processes.
+	Status(context.Context, *StatusRequest) (*StatusReply, error)
+	// StreamLogs streams console output lines until the client cancels.
+	StreamLogs(*StreamLogsRequest, SafeWork_StreamLogsServer) error
+	// Cleanup runs the cleanup commands, and exits the instance if asked.
+	Cleanup(context.Context, *CleanupRequest) (*CleanupReply, error)
+	mustEmbedUnimplementedSafeWorkServer()
+}
+
+// UnimplementedSafeWorkServer must be embedded to have forward compatible implementations.
+type UnimplementedSafeWorkServer struct {
+}
+
+func (UnimplementedSafeWorkServer) RunTask(context.Context, *RunTaskRequest) (*Report, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RunTask not implemented")
+}
+func (UnimplementedSafeWorkServer) Status(context.Context, *StatusRequest) (*StatusReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
+func (UnimplementedSafeWorkServer) StreamLogs(*StreamLogsRequest, SafeWork_StreamLogsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamLogs not implemented")
+}
+func (UnimplementedSafeWorkServer) Cleanup(context.Context, *CleanupRequest) (*CleanupReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Cleanup not implemented")
+}
+func (UnimplementedSafeWorkServer) mustEmbedUnimplementedSafeWorkServer() {}
+
+// UnsafeSafeWorkServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SafeWorkServer will
+// result in compilation errors.
+type UnsafeSafeWorkServer interface {
+	mustEmbedUnimplementedSafeWorkServer()
+}
+
+func RegisterSafeWorkServer(s grpc.ServiceRegistrar, srv SafeWorkServer) {
+	s.RegisterService(&SafeWork_ServiceDesc, srv)
+}
+
+func _SafeWork_RunTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RunTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SafeWorkServer).RunTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SafeWork_RunTask_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SafeWorkServer).RunTask(ctx, req.(*RunTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SafeWork_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SafeWorkServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SafeWork_Status_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SafeWorkServer).Status(ctx, req.(*StatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SafeWork_StreamLogs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamLogsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SafeWorkServer).StreamLogs(m, &safeWorkStreamLogsServer{stream})
+}
+
+type SafeWork_StreamLogsServer interface {
+	Send(*LogLine) error
+	grpc.ServerStream
+}
+
+type safeWorkStreamLogsServer struct {
+	grpc.ServerStream
+}
+
+func (x *safeWorkStreamLogsServer) Send(m *LogLine) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _SafeWork_Cleanup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CleanupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SafeWorkServer).Cleanup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SafeWork_Cleanup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SafeWorkServer).Cleanup(ctx, req.(*CleanupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SafeWork_ServiceDesc is the grpc.ServiceDesc for SafeWork service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SafeWork_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "safework.SafeWork",
+	HandlerType: (*SafeWorkServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "RunTask",
+			Handler:    _SafeWork_RunTask_Handler,
+		},
+		{
+			MethodName: "Status",
+			Handler:    _SafeWork_Status_Handler,
+		},
+		{
+			MethodName: "Cleanup",
+			Handler:    _SafeWork_Cleanup_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamLogs",
+			Handler:       _SafeWork_StreamLogs_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "safework.proto",
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	appModeHide     = "hide"
+	appModeMinimize = "minimize"
+	appModeClose    = "close"
+	appModeDesktop  = "desktop"
+)
+
+type AppSpec struct {
+	Name string   `json:"name"`
+	Args []string `json:"args,omitempty"`
+	Mode string   `json:"mode,omitempty"`
+
+	// Desktop is the 1-based virtual desktop used by the desktop mode, which
+	// only Linux (wmctrl or sway) supports.
+	Desktop int `json:"desktop,omitempty"`
+
+	// Path, Dir and Placement are used by show_apps to cold-start an app
+	// that is not running. Path defaults to Name.
+	Path      string           `json:"path,omitempty"`
+	Dir       string           `json:"dir,omitempty"`
+	Placement *WindowPlacement `json:"placement,omitempty"`
+
+	// Mute silences the app's audio while it is hidden.
+	Mute bool `json:"mute,omitempty"`
+}
+
+var (
+	closedMutex sync.Mutex
+	closedApps  []AppSpec
+	mutedApps   []string
+)
+
+// UnmarshalJSON accepts either a bare app name or an object.
+func (a *AppSpec) UnmarshalJSON(b []byte) error {
+	var name string
+	if json.Unmarshal(b, &name) == nil {
+		*a = AppSpec{Name: name}
+		return nil
+	}
+
+	type plain AppSpec
+	err := json.Unmarshal(b, (*plain)(a))
+	if err != nil {
+		return err
+	}
+
+	switch a.Mode {
+	case "", appModeHide, appModeMinimize, appModeClose:
+		return nil
+	case appModeDesktop:
+		if errDesktopMode != nil {
+			return fmt.Errorf("app %s: %s", a.Name, errDesktopMode)
+		}
+		if a.Desktop < 1 {
+			return fmt.Errorf("app %s: desktop mode needs desktop >= 1", a.Name)
+		}
+		return nil
+	default:
+		return fmt.Errorf("app %s: unknown mode %q, expect hide, minimize, close or desktop", a.Name, a.Mode)
+	}
+}
+
+func (a AppSpec) mode() string {
+	if a.Mode == "" {
+		return appModeHide
+	}
+	return a.Mode
+}
+
+func (a AppSpec) launchPath() string {
+	if a.Path == "" {
+		return a.Name
+	}
+	return os.ExpandEnv(a.Path)
+}
+
+func (a AppSpec) launchArgs() []string {
+	args := make([]string, len(a.Args))
+	for i, arg := range a.Args {
+		args[i] = os.ExpandEnv(arg)
+	}
+	return args
+}
+
+// startApp launches an app and places its first window once it shows up.
+func startApp(app AppSpec) error {
+	logInfo("launch: %s %s", app.launchPath(), strings.Join(app.launchArgs(), " "))
+	err := launchApp(app)
+	if err != nil {
+		return err
+	}
+	placeApp(app, 30*time.Second)
+	return nil
+}
+
+// placeApp moves the app's window to its placement in the background,
+// retrying until the window exists or the timeout passes.
+func placeApp(app AppSpec, timeout time.Duration) {
+	if app.Placement == nil || app.Placement.empty() {
+		return
+	}
+
+	go func() {
+		match := WindowMatch{Process: app.Name}
+		deadline := time.Now().Add(timeout)
+		for {
+			err := focusWindow(match, app.Placement)
+			if err == nil {
+				return
+			}
+			if time.Now().After(deadline) {
+				logError("---> place %s: %s", app.Name, err)
+				return
+			}
+			time.Sleep(500 * time.Millisecond)
+		}
+	}()
+}
+
+func recordClosedApp(app AppSpec) {
+	closedMutex.Lock()
+	defer closedMutex.Unlock()
+
+	for _, closed := range closedApps {
+		if closed.Name == app.Name {
+			return
+		}
+	}
+	closedApps = append(closedApps, app)
+}
+
+// relaunchClosedApp starts an app again if hideApps closed it.
+func relaunchClosedApp(name string) (bool, error) {
+	closedMutex.Lock()
+	var app AppSpec
+	found := false
+	for i, closed := range closedApps {
+		if closed.Name == name {
+			app, found = closed, true
+			closedApps = append(closedApps[:i], closedApps[i+1:]...)
+			break
+		}
+	}
+	closedMutex.Unlock()
+
+	if !found {
+		return false, nil
+	}
+
+	logInfo("relaunch: %s", app.Name)
+	return true, startApp(app)
+}
+
+func muteApps(apps []AppSpec) error {
+	for _, app := range apps {
+		if !app.Mute {
+			continue
+		}
+		err := setAppMute(app.Name, true)
+		if err != nil {
+			return fmt.Errorf("mute %s: %s", app.Name, err)
+		}
+
+		closedMutex.Lock()
+		if !containsString(mutedApps, app.Name) {
+			mutedApps = append(mutedApps, app.Name)
+		}
+		closedMutex.Unlock()
+	}
+	return nil
+}
+
+// unmuteApps only touches apps that muteApps silenced.
+func unmuteApps(apps []AppSpec) error {
+	for _, app := range apps {
+		closedMutex.Lock()
+		muted := false
+		for i, name := range mutedApps {
+			if name == app.Name {
+				muted = true
+				mutedApps = append(mutedApps[:i], mutedApps[i+1:]...)
+				break
+			}
+		}
+		closedMutex.Unlock()
+
+		if muted {
+			err := setAppMute(app.Name, false)
+			if err != nil {
+				return fmt.Errorf("unmute %s: %s", app.Name, err)
+			}
+		}
+	}
+	return nil
+}
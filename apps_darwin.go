@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// desktop mode is rejected at config load, see AppSpec.UnmarshalJSON
+var errDesktopMode = errors.New("macOS has no public API to move windows between Spaces, use hide or minimize")
+
+const appScript = `on run argv
+	set key to item 1 of argv
+	set isBundle to (item 2 of argv) is "bundle"
+	set action to item 3 of argv
+	tell application "System Events"
+		if isBundle then
+			set procs to (processes whose bundle identifier is key)
+		else
+			set procs to (processes whose name is key)
+		end if
+		if (count of procs) is 0 then return "missing"
+		set proc to item 1 of procs
+		if action is "hide" then
+			set visible of proc to false
+		else if action is "minimize" then
+			repeat with w in windows of proc
+				set value of attribute "AXMinimized" of w to true
+			end repeat
+		else if action is "show" then
+			set visible of proc to true
+			repeat with w in windows of proc
+				set value of attribute "AXMinimized" of w to false
+			end repeat
+		end if
+	end tell
+	if action is "close" then
+		if isBundle then
+			tell application id key to quit
+		else
+			tell application key to quit
+		end if
+	else if action is "show" then
+		if isBundle then
+			tell application id key to activate
+		else
+			tell application key to activate
+		end if
+	end if
+	return "ok"
+end run`
+
+// isBundleID tells com.example.App from an app name like "Google Chrome".
+func isBundleID(name string) bool {
+	return strings.Count(name, ".") >= 2 && !strings.Contains(name, " ")
+}
+
+func appAction(name, action string) (bool, error) {
+	kind := "name"
+	if isBundleID(name) {
+		kind = "bundle"
+	}
+
+	out, err := exec.Command("osascript", "-e", appScript, name, kind, action).CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("%s, %s", err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)) == "ok", nil
+}
+
+func hideApps(apps []AppSpec) error {
+	for _, app := range apps {
+		if app.mode() == appModeDesktop {
+			logError("---> %s: %s", app.Name, errDesktopMode)
+			continue
+		}
+
+		found, err := appAction(app.Name, app.mode())
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		if app.mode() == appModeClose {
+			recordClosedApp(app)
+		}
+		logInfo("%s: %s", app.mode(), app.Name)
+	}
+	return nil
+}
+
+func restoreApps(apps []AppSpec) error {
+	for _, app := range apps {
+		relaunched, err := relaunchClosedApp(app.Name)
+		if err != nil {
+			return err
+		}
+		if relaunched {
+			continue
+		}
+
+		found, err := appAction(app.Name, "show")
+		if err != nil {
+			return err
+		}
+		if found {
+			logInfo("restore: %s", app.Name)
+		}
+	}
+	return nil
+}
+
+func showApps(apps []AppSpec) error {
+	for _, app := range apps {
+		found, err := appAction(app.Name, "show")
+		if err != nil {
+			return err
+		}
+		if found {
+			logInfo("show: %s", app.Name)
+			placeApp(app, 0)
+			continue
+		}
+
+		relaunched, err := relaunchClosedApp(app.Name)
+		if err != nil {
+			return err
+		}
+		if relaunched {
+			continue
+		}
+
+		err = startApp(app)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func launchApp(app AppSpec) error {
+	name, args := app.launchPath(), app.launchArgs()
+	flag := "-a"
+	if isBundleID(name) {
+		flag = "-b"
+	}
+
+	cmdArgs := []string{flag, name}
+	if len(args) > 0 {
+		cmdArgs = append(cmdArgs, "--args")
+		cmdArgs = append(cmdArgs, args...)
+	}
+	return runQuiet(exec.Command("open", cmdArgs...))
+}
+
+// switchDesktop presses CTRL+LEFT/RIGHT, the default Mission Control
+// shortcut for moving between Spaces.
+func switchDesktop(delta int) error {
+	code := "124"
+	if delta < 0 {
+		code = "123"
+		delta = -delta
+	}
+	for i := 0; i < delta; i++ {
+		err := runQuiet(exec.Command("osascript", "-e", `tell application "System Events" to key code `+code+` using control down`))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
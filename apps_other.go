@@ -0,0 +1,287 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type x11Window struct {
+	id      string
+	pid     int
+	process string
+	mode    string
+}
+
+var (
+	hiddenMutex   sync.Mutex
+	hiddenWindows []x11Window
+
+	// wmctrl and sway can move windows to a desktop
+	errDesktopMode error
+)
+
+func isSway() bool {
+	return os.Getenv("SWAYSOCK") != ""
+}
+
+func checkDisplay() error {
+	if isSway() || os.Getenv("DISPLAY") != "" {
+		return nil
+	}
+	return errors.New("no X11 display, on Wayland only sway is supported")
+}
+
+func processName(pid int) string {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err == nil {
+		return strings.TrimSpace(string(b))
+	}
+	out, _ := exec.Command("ps", "-p", strconv.Itoa(pid), "-o", "comm=").Output()
+	return strings.TrimSpace(string(out))
+}
+
+// x11Windows lists managed windows through `wmctrl -lp`.
+func x11Windows() ([]x11Window, error) {
+	out, err := exec.Command("wmctrl", "-lp").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var wins []x11Window
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		pid, _ := strconv.Atoi(fields[2])
+		wins = append(wins, x11Window{id: fields[0], pid: pid, process: processName(pid)})
+	}
+	return wins, nil
+}
+
+func hideApps(apps []AppSpec) error {
+	err := checkDisplay()
+	if err != nil {
+		return err
+	}
+
+	hiddenMutex.Lock()
+	defer hiddenMutex.Unlock()
+
+	if isSway() {
+		for _, app := range apps {
+			pids, _ := findProcesses(app.Name)
+			if len(pids) == 0 {
+				continue
+			}
+			for _, pid := range pids {
+				criteria := fmt.Sprintf("[pid=%d]", pid)
+				if app.mode() == appModeClose {
+					runQuiet(exec.Command("swaymsg", criteria, "kill"))
+				} else if app.mode() == appModeDesktop {
+					runQuiet(exec.Command("swaymsg", criteria, "move", "container", "to", "workspace", "number", strconv.Itoa(app.Desktop)))
+					hiddenWindows = append(hiddenWindows, x11Window{pid: pid, process: app.Name, mode: appModeDesktop})
+				} else if runQuiet(exec.Command("swaymsg", criteria, "move", "scratchpad")) == nil {
+					hiddenWindows = append(hiddenWindows, x11Window{pid: pid, process: app.Name, mode: appModeHide})
+				}
+			}
+			if app.mode() == appModeClose {
+				recordClosedApp(app)
+			}
+			logInfo("%s: %s", app.mode(), app.Name)
+		}
+		return nil
+	}
+
+	wins, err := x11Windows()
+	if err != nil {
+		return err
+	}
+	for _, app := range apps {
+		count := 0
+		for _, w := range wins {
+			if !(WindowMatch{Process: app.Name}).matchProcess(w.process) {
+				continue
+			}
+
+			w.mode = app.mode()
+			switch w.mode {
+			case appModeClose:
+				err = runQuiet(exec.Command("wmctrl", "-i", "-c", w.id))
+			case appModeMinimize:
+				err = runQuiet(exec.Command("xdotool", "windowminimize", w.id))
+			case appModeDesktop:
+				err = runQuiet(exec.Command("wmctrl", "-i", "-r", w.id, "-t", strconv.Itoa(app.Desktop-1)))
+			default:
+				err = runQuiet(exec.Command("xdotool", "windowunmap", w.id))
+			}
+			if err != nil {
+				return err
+			}
+			if w.mode != appModeClose {
+				hiddenWindows = append(hiddenWindows, w)
+			}
+			count++
+		}
+		if count > 0 && app.mode() == appModeClose {
+			recordClosedApp(app)
+		}
+		logInfo("%s: %s (%d windows)", app.mode(), app.Name, count)
+	}
+	return nil
+}
+
+// restoreHidden maps the windows hideApps hid, the caller holds hiddenMutex.
+func restoreHidden(match WindowMatch) int {
+	restored := 0
+	remain := hiddenWindows[:0]
+	for _, w := range hiddenWindows {
+		if !match.matchProcess(w.process) {
+			remain = append(remain, w)
+			continue
+		}
+		switch {
+		case isSway():
+			runQuiet(exec.Command("swaymsg", fmt.Sprintf("[pid=%d]", w.pid), "move", "container", "to", "workspace", "current,", "floating", "disable"))
+		case w.mode == appModeMinimize:
+			runQuiet(exec.Command("xdotool", "windowactivate", w.id))
+		case w.mode == appModeDesktop:
+			if desktop, err := currentDesktop(); err == nil {
+				runQuiet(exec.Command("wmctrl", "-i", "-r", w.id, "-t", strconv.Itoa(desktop)))
+			}
+		default:
+			runQuiet(exec.Command("xdotool", "windowmap", w.id))
+		}
+		restored++
+	}
+	hiddenWindows = remain
+	return restored
+}
+
+func restoreApps(apps []AppSpec) error {
+	err := checkDisplay()
+	if err != nil {
+		return err
+	}
+
+	hiddenMutex.Lock()
+	defer hiddenMutex.Unlock()
+
+	for _, app := range apps {
+		relaunched, err := relaunchClosedApp(app.Name)
+		if err != nil {
+			return err
+		}
+		if !relaunched {
+			n := restoreHidden(WindowMatch{Process: app.Name})
+			logInfo("restore: %s (%d windows)", app.Name, n)
+		}
+	}
+	return nil
+}
+
+func showApps(apps []AppSpec) error {
+	err := checkDisplay()
+	if err != nil {
+		return err
+	}
+
+	hiddenMutex.Lock()
+	defer hiddenMutex.Unlock()
+
+	for _, app := range apps {
+		match := WindowMatch{Process: app.Name}
+		restored := restoreHidden(match)
+
+		pids, _ := findProcesses(app.Name)
+		if len(pids) > 0 {
+			if isSway() {
+				runQuiet(exec.Command("swaymsg", fmt.Sprintf("[pid=%d]", pids[0]), "focus"))
+			} else {
+				wmctrl(match, "-a")
+				placeApp(app, 0)
+			}
+			logInfo("show: %s (%d windows restored)", app.Name, restored)
+			continue
+		}
+
+		relaunched, err := relaunchClosedApp(app.Name)
+		if err != nil {
+			return err
+		}
+		if relaunched {
+			continue
+		}
+
+		err = startApp(app)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func launchApp(app AppSpec) error {
+	cmd := exec.Command(app.launchPath(), app.launchArgs()...)
+	cmd.Dir = os.ExpandEnv(app.Dir)
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// currentDesktop returns the 0-based desktop marked with * by `wmctrl -d`.
+func currentDesktop() (int, error) {
+	out, err := exec.Command("wmctrl", "-d").Output()
+	if err != nil {
+		return 0, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[1] == "*" {
+			return strconv.Atoi(fields[0])
+		}
+	}
+	return 0, errors.New("current desktop not found")
+}
+
+func switchDesktop(delta int) error {
+	if isSway() {
+		dir := "next"
+		if delta < 0 {
+			dir = "prev"
+		}
+		return runQuiet(exec.Command("swaymsg", "workspace", dir))
+	}
+
+	err := checkDisplay()
+	if err != nil {
+		return err
+	}
+	out, err := exec.Command("wmctrl", "-d").Output()
+	if err != nil {
+		return err
+	}
+	count := len(strings.Split(strings.TrimSpace(string(out)), "\n"))
+	cur, err := currentDesktop()
+	if err != nil {
+		return err
+	}
+
+	next := ((cur+delta)%count + count) % count
+	return runQuiet(exec.Command("wmctrl", "-s", strconv.Itoa(next)))
+}
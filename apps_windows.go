@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	swShowNormal = 1
+	swMinimize   = 6
+)
+
+type hiddenWindow struct {
+	window
+	mode string
+}
+
+var (
+	// desktop mode is rejected at config load, see AppSpec.UnmarshalJSON
+	errDesktopMode = errors.New("moving other apps' windows between virtual desktops is not supported by the Windows API, use hide or minimize")
+
+	shell32           = syscall.NewLazyDLL("shell32.dll")
+	procShellExecuteW = shell32.NewProc("ShellExecuteW")
+
+	hiddenMutex   sync.Mutex
+	hiddenWindows []hiddenWindow
+)
+
+func hideApps(apps []AppSpec) error {
+	hiddenMutex.Lock()
+	defer hiddenMutex.Unlock()
+
+	for _, app := range apps {
+		wins := findWindows(WindowMatch{Process: app.Name}, false)
+		if len(wins) == 0 {
+			continue
+		}
+
+		switch app.mode() {
+		case appModeDesktop:
+			logError("---> %s: %s", app.Name, errDesktopMode)
+			continue
+		case appModeClose:
+			pids := make(map[uint32]bool)
+			for _, w := range wins {
+				pids[w.pid] = true
+			}
+			for pid := range pids {
+				killProcess(int(pid), false)
+			}
+			recordClosedApp(app)
+		case appModeMinimize:
+			for _, w := range wins {
+				procShowWindow.Call(w.hwnd, swMinimize)
+				hiddenWindows = append(hiddenWindows, hiddenWindow{w, appModeMinimize})
+			}
+		default:
+			for _, w := range wins {
+				procShowWindow.Call(w.hwnd, swHide)
+				hiddenWindows = append(hiddenWindows, hiddenWindow{w, appModeHide})
+			}
+		}
+		logInfo("%s: %s (%d windows)", app.mode(), app.Name, len(wins))
+	}
+	return nil
+}
+
+// restoreHidden shows the windows hideApps hid, the caller holds hiddenMutex.
+func restoreHidden(match WindowMatch) int {
+	restored := 0
+	remain := hiddenWindows[:0]
+	for _, w := range hiddenWindows {
+		if !match.matchProcess(w.process) {
+			remain = append(remain, w)
+			continue
+		}
+		if w.mode == appModeMinimize {
+			procShowWindow.Call(w.hwnd, swRestore)
+		} else {
+			procShowWindow.Call(w.hwnd, swShow)
+		}
+		restored++
+	}
+	hiddenWindows = remain
+	return restored
+}
+
+func restoreApps(apps []AppSpec) error {
+	hiddenMutex.Lock()
+	defer hiddenMutex.Unlock()
+
+	for _, app := range apps {
+		relaunched, err := relaunchClosedApp(app.Name)
+		if err != nil {
+			return err
+		}
+		if !relaunched {
+			n := restoreHidden(WindowMatch{Process: app.Name})
+			logInfo("restore: %s (%d windows)", app.Name, n)
+		}
+	}
+	return nil
+}
+
+func showApps(apps []AppSpec) error {
+	hiddenMutex.Lock()
+	defer hiddenMutex.Unlock()
+
+	for _, app := range apps {
+		match := WindowMatch{Process: app.Name}
+		restored := restoreHidden(match)
+		wins := findWindows(match, false)
+		if len(wins) > 0 {
+			if app.Placement != nil {
+				placeWindow(wins[0].hwnd, app.Placement)
+			}
+			activateWindow(wins[0].hwnd)
+			logInfo("show: %s (%d windows restored)", app.Name, restored)
+			continue
+		}
+
+		pids, _ := findProcesses(app.Name)
+		if len(pids) > 0 {
+			logInfo("show: %s is running without a window", app.Name)
+			continue
+		}
+
+		relaunched, err := relaunchClosedApp(app.Name)
+		if err != nil {
+			return err
+		}
+		if relaunched {
+			continue
+		}
+
+		err = startApp(app)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// launchApp uses ShellExecute so that names registered under App Paths,
+// like chrome.exe, resolve without being in PATH.
+func launchApp(app AppSpec) error {
+	file, args := app.launchPath(), app.launchArgs()
+	params := make([]string, len(args))
+	for i, arg := range args {
+		params[i] = syscall.EscapeArg(arg)
+	}
+
+	verb, _ := syscall.UTF16PtrFromString("open")
+	f, err := syscall.UTF16PtrFromString(file)
+	if err != nil {
+		return err
+	}
+	p, err := syscall.UTF16PtrFromString(strings.Join(params, " "))
+	if err != nil {
+		return err
+	}
+
+	var dir *uint16
+	if app.Dir != "" {
+		dir, err = syscall.UTF16PtrFromString(os.ExpandEnv(app.Dir))
+		if err != nil {
+			return err
+		}
+	}
+
+	ret, _, _ := procShellExecuteW.Call(0, uintptr(unsafe.Pointer(verb)), uintptr(unsafe.Pointer(f)), uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(dir)), swShowNormal)
+	if ret <= 32 {
+		return fmt.Errorf("launch %s failed, code %d", file, ret)
+	}
+	return nil
+}
+
+// switchDesktop sends CTRL+WIN+LEFT/RIGHT, the shell shortcut for
+// switching virtual desktops.
+func switchDesktop(delta int) error {
+	const (
+		vkControl = 0x11
+		vkLWin    = 0x5B
+		vkLeft    = 0x25
+		vkRight   = 0x27
+	)
+
+	arrow := uintptr(vkRight)
+	if delta < 0 {
+		arrow = vkLeft
+		delta = -delta
+	}
+	for i := 0; i < delta; i++ {
+		procKeybdEvent.Call(vkControl, 0, 0, 0)
+		procKeybdEvent.Call(vkLWin, 0, 0, 0)
+		procKeybdEvent.Call(arrow, 0, 0, 0)
+		procKeybdEvent.Call(arrow, 0, keyeventfKeyUp, 0)
+		procKeybdEvent.Call(vkLWin, 0, keyeventfKeyUp, 0)
+		procKeybdEvent.Call(vkControl, 0, keyeventfKeyUp, 0)
+	}
+	return nil
+}
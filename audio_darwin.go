@@ -0,0 +1,7 @@
+package main
+
+import "errors"
+
+func setAppMute(name string, mute bool) error {
+	return errors.New("macOS has no public API to mute a single app")
+}
@@ -0,0 +1,49 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// setAppMute mutes the PulseAudio or PipeWire sink inputs of a process.
+func setAppMute(name string, mute bool) error {
+	cmd := exec.Command("pactl", "list", "sink-inputs")
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	out, err := cmd.Output()
+	if err != nil {
+		return err
+	}
+
+	flag := "0"
+	if mute {
+		flag = "1"
+	}
+
+	var index string
+	match := WindowMatch{Process: name}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "Sink Input #") {
+			index = strings.TrimPrefix(line, "Sink Input #")
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, " = ")
+		if !ok || key != "application.process.binary" {
+			continue
+		}
+		if match.matchProcess(strings.Trim(value, `"`)) {
+			err = runQuiet(exec.Command("pactl", "set-sink-input-mute", index, flag))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
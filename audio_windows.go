@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	clsctxAll           = 0x17
+	coinitMultithreaded = 0
+	eRender             = 0
+	deviceStateActive   = 1
+	rpcEChangedMode     = 0x80010106
+)
+
+var (
+	ole32                = syscall.NewLazyDLL("ole32.dll")
+	procCoInitializeEx   = ole32.NewProc("CoInitializeEx")
+	procCoUninitialize   = ole32.NewProc("CoUninitialize")
+	procCoCreateInstance = ole32.NewProc("CoCreateInstance")
+
+	clsidMMDeviceEnumerator  = syscall.GUID{Data1: 0xBCDE0395, Data2: 0xE52F, Data3: 0x467C, Data4: [8]byte{0x8E, 0x3D, 0xC4, 0x57, 0x92, 0x91, 0x69, 0x2E}}
+	iidIMMDeviceEnumerator   = syscall.GUID{Data1: 0xA95664D2, Data2: 0x9614, Data3: 0x4F35, Data4: [8]byte{0xA7, 0x46, 0xDE, 0x8D, 0xB6, 0x36, 0x17, 0xE6}}
+	iidIAudioSessionManager2 = syscall.GUID{Data1: 0x77AA99A0, Data2: 0x1BD6, Data3: 0x484F, Data4: [8]byte{0x8B, 0xC7, 0x2C, 0x65, 0x4C, 0x9A, 0x9B, 0x6F}}
+	iidIAudioSessionControl2 = syscall.GUID{Data1: 0xBFB7FF88, Data2: 0x7239, Data3: 0x4FC9, Data4: [8]byte{0x8F, 0xA2, 0x07, 0xC9, 0x50, 0xBE, 0x9C, 0x6D}}
+	iidISimpleAudioVolume    = syscall.GUID{Data1: 0x87CE5498, Data2: 0x68D6, Data3: 0x44E5, Data4: [8]byte{0x92, 0x15, 0x6D, 0xA4, 0x7E, 0xF8, 0x83, 0xD8}}
+)
+
+type comObject struct {
+	vtbl *[32]uintptr
+}
+
+// comCall invokes method i of a COM object's vtable.
+func comCall(obj *comObject, i int, args ...uintptr) uintptr {
+	ret, _, _ := syscall.SyscallN(obj.vtbl[i], append([]uintptr{uintptr(unsafe.Pointer(obj))}, args...)...)
+	return ret
+}
+
+func comRelease(obj *comObject) {
+	if obj != nil {
+		comCall(obj, 2)
+	}
+}
+
+// setAppMute mutes the audio sessions of a process on every active output
+// device through the Windows audio session API.
+func setAppMute(name string, mute bool) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	hr, _, _ := procCoInitializeEx.Call(0, coinitMultithreaded)
+	if hr != rpcEChangedMode {
+		defer procCoUninitialize.Call()
+	}
+
+	var enumerator *comObject
+	hr, _, _ = procCoCreateInstance.Call(uintptr(unsafe.Pointer(&clsidMMDeviceEnumerator)), 0, clsctxAll,
+		uintptr(unsafe.Pointer(&iidIMMDeviceEnumerator)), uintptr(unsafe.Pointer(&enumerator)))
+	if int32(hr) < 0 {
+		return fmt.Errorf("create device enumerator failed, 0x%08x", uint32(hr))
+	}
+	defer comRelease(enumerator)
+
+	var devices *comObject
+	hr = comCall(enumerator, 3, eRender, deviceStateActive, uintptr(unsafe.Pointer(&devices)))
+	if int32(hr) < 0 {
+		return fmt.Errorf("enumerate audio devices failed, 0x%08x", uint32(hr))
+	}
+	defer comRelease(devices)
+
+	var count uint32
+	comCall(devices, 3, uintptr(unsafe.Pointer(&count)))
+
+	names := processNames()
+	match := WindowMatch{Process: name}
+	bmute := uintptr(0)
+	if mute {
+		bmute = 1
+	}
+
+	for i := uint32(0); i < count; i++ {
+		var device, manager, sessions *comObject
+		comCall(devices, 4, uintptr(i), uintptr(unsafe.Pointer(&device)))
+		if device == nil {
+			continue
+		}
+		comCall(device, 3, uintptr(unsafe.Pointer(&iidIAudioSessionManager2)), clsctxAll, 0, uintptr(unsafe.Pointer(&manager)))
+		comRelease(device)
+		if manager == nil {
+			continue
+		}
+		comCall(manager, 5, uintptr(unsafe.Pointer(&sessions)))
+		comRelease(manager)
+		if sessions == nil {
+			continue
+		}
+
+		var n int32
+		comCall(sessions, 3, uintptr(unsafe.Pointer(&n)))
+		for j := int32(0); j < n; j++ {
+			var control, control2, volume *comObject
+			comCall(sessions, 4, uintptr(j), uintptr(unsafe.Pointer(&control)))
+			if control == nil {
+				continue
+			}
+			comCall(control, 0, uintptr(unsafe.Pointer(&iidIAudioSessionControl2)), uintptr(unsafe.Pointer(&control2)))
+			if control2 != nil {
+				var pid uint32
+				comCall(control2, 14, uintptr(unsafe.Pointer(&pid)))
+				if pid != 0 && match.matchProcess(names[pid]) {
+					comCall(control, 0, uintptr(unsafe.Pointer(&iidISimpleAudioVolume)), uintptr(unsafe.Pointer(&volume)))
+					if volume != nil {
+						comCall(volume, 5, bmute, 0)
+						comRelease(volume)
+					}
+				}
+				comRelease(control2)
+			}
+			comRelease(control)
+		}
+		comRelease(sessions)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runAutostart handles `safework autostart enable|disable [--tray] [config dir]`.
+func runAutostart(args []string) int {
+	fs := flag.NewFlagSet("autostart", flag.ContinueOnError)
+	tray := fs.Bool("tray", false, "start with the tray icon")
+	if len(args) == 0 || fs.Parse(args[1:]) != nil || fs.NArg() > 1 {
+		fmt.Println("usage: safework autostart enable|disable [--tray] [config dir]")
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "enable":
+		err = enableAutostartFor(fs.Arg(0), *tray)
+	case "disable":
+		err = disableAutostart()
+		if err == nil {
+			fmt.Println("autostart disabled")
+		}
+	default:
+		err = fmt.Errorf("unknown autostart command %s", args[0])
+	}
+
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func enableAutostartFor(dir string, tray bool) error {
+	dir = resolveConfigDir(dir)
+	err := loadConfig(dir)
+	if err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	argv := []string{exe}
+	if tray {
+		argv = append(argv, "-tray")
+	}
+	argv = append(argv, dir)
+
+	where, err := enableAutostart(argv)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("autostart enabled: %s\n", where)
+	return nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import "os"
+
+func enableAutostart(argv []string) (string, error) {
+	return writeLaunchAgent(argv)
+}
+
+func disableAutostart() error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(launchAgentPath(home))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const autostartEntry = `[Desktop Entry]
+Type=Application
+Name=safework
+Comment=Run safework startup at login
+Exec=%s
+X-GNOME-Autostart-enabled=true
+`
+
+func autostartPath() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "autostart", "safework.desktop"), nil
+}
+
+func enableAutostart(argv []string) (string, error) {
+	path, err := autostartPath()
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	// desktop entry Exec keys quote args with spaces and escape "`$\
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		if strings.ContainsAny(arg, " \t\"'`$\\") {
+			arg = `"` + strings.NewReplacer(`"`, `\"`, "`", "\\`", `$`, `\$`, `\`, `\\`).Replace(arg) + `"`
+		}
+		quoted[i] = strings.ReplaceAll(arg, "%", "%%")
+	}
+
+	entry := strings.Replace(autostartEntry, "%s", strings.Join(quoted, " "), 1)
+	return path, ioutil.WriteFile(path, []byte(entry), 0644)
+}
+
+func disableAutostart() error {
+	path, err := autostartPath()
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const autostartKey = `Software\Microsoft\Windows\CurrentVersion\Run`
+
+func enableAutostart(argv []string) (string, error) {
+	k, _, err := registry.CreateKey(registry.CURRENT_USER, autostartKey, registry.SET_VALUE)
+	if err != nil {
+		return "", err
+	}
+	defer k.Close()
+
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		quoted[i] = syscall.EscapeArg(arg)
+	}
+	return `HKCU\` + autostartKey + `\safework`, k.SetStringValue("safework", strings.Join(quoted, " "))
+}
+
+func disableAutostart() error {
+	k, err := registry.OpenKey(registry.CURRENT_USER, autostartKey, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+
+	err = k.DeleteValue("safework")
+	if err == registry.ErrNotExist {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// clientCommands talk to a running instance over the ipc socket.
+var clientCommands = map[string]func(args []string) int{
+	"stop":    runStopCommand,
+	"status":  runStatusCommand,
+	"ps":      runPsCommand,
+	"reload":  runReloadCommand,
+	"run":     runTaskCommand,
+	"trigger": runTriggerCommand,
+	"tui":     runTUI,
+}
+
+// splitDirArg takes n leading arguments and an optional config dir.
+func splitDirArg(args []string, n int, usage string) ([]string, string, bool) {
+	if len(args) < n || len(args) > n+1 {
+		fmt.Printf("usage: safework %s\n", usage)
+		return nil, "", false
+	}
+
+	dir := ""
+	if len(args) > n {
+		dir = args[n]
+	}
+	return args[:n], resolveConfigDir(dir), true
+}
+
+func runStopCommand(args []string) int {
+	_, dir, ok := splitDirArg(args, 0, "stop [config dir]")
+	if !ok {
+		return 2
+	}
+
+	_, err := ipcCall(dir, "stop")
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+	fmt.Println("stopping")
+
+	// wait for cleanup, so service managers don't kill it halfway
+	deadline := time.Now().Add(5 * time.Minute)
+	for time.Now().Before(deadline) {
+		time.Sleep(200 * time.Millisecond)
+		if _, err := ipcCall(dir, "ping"); err != nil {
+			fmt.Println("stopped")
+			return 0
+		}
+	}
+	fmt.Println("ERR: instance still running")
+	return 1
+}
+
+func runReloadCommand(args []string) int {
+	_, dir, ok := splitDirArg(args, 0, "reload [config dir]")
+	if !ok {
+		return 2
+	}
+
+	_, err := ipcCall(dir, "reload")
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+	fmt.Println("reloaded")
+	return 0
+}
+
+func runTriggerCommand(args []string) int {
+	names, dir, ok := splitDirArg(args, 1, "trigger <action> [config dir]")
+	if !ok {
+		return 2
+	}
+
+	_, err := ipcCall(dir, "trigger", names[0])
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+	fmt.Printf("triggered: %s\n", names[0])
+	return 0
+}
+
+func runTaskCommand(args []string) int {
+	names, dir, ok := splitDirArg(args, 1, "run <task|startup|cleanup> [config dir]")
+	if !ok {
+		return 2
+	}
+
+	if _, err := ipcCall(dir, "ping"); err != nil {
+		return runOnce(names[0], dir)
+	}
+	b, err := ipcCall(dir, "run", names[0])
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+
+	var report reportStatus
+	err = json.Unmarshal(b, &report)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+	printReportStatus(report)
+	if report.Status != "ok" {
+		return 1
+	}
+	return 0
+}
+
+func runStatusCommand(args []string) int {
+	_, dir, ok := splitDirArg(args, 0, "status [config dir]")
+	if !ok {
+		return 2
+	}
+
+	b, err := ipcCall(dir, "status")
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+
+	var status instanceStatus
+	err = json.Unmarshal(b, &status)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+
+	if status.Startup != nil {
+		printReportStatus(*status.Startup)
+	}
+	names := make([]string, 0, len(status.Tasks))
+	for name := range status.Tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		printReportStatus(status.Tasks[name])
+	}
+
+	if len(status.Processes) > 0 {
+		printProcesses(status.Processes)
+	}
+	return 0
+}
+
+// runPsCommand lists what the instance started and whether it still runs.
+func runPsCommand(args []string) int {
+	_, dir, ok := splitDirArg(args, 0, "ps [config dir]")
+	if !ok {
+		return 2
+	}
+
+	b, err := ipcCall(dir, "status")
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+
+	var status instanceStatus
+	err = json.Unmarshal(b, &status)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+
+	if len(status.Processes) == 0 {
+		fmt.Println("no managed processes")
+		return 0
+	}
+	printProcesses(status.Processes)
+	return 0
+}
+
+func printProcesses(procs []processStatus) {
+	fmt.Println()
+	fmt.Println("[PROCESSES]")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPID\tSTATE\tSTARTED\tRESTARTS\tCPU\tMEMORY\tHANDLES")
+	for _, p := range procs {
+		state := "dead"
+		if p.Alive {
+			state = "alive"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%d\t%.1f%%\t%s\t%d\n", p.Name, p.Pid, state, p.Started.Format("2006-01-02 15:04:05"), p.Restarts,
+			p.CPU, formatBytes(p.Memory), p.Handles)
+	}
+	w.Flush()
+}
+
+func printReportStatus(r reportStatus) {
+	fmt.Println()
+	fmt.Printf("[%s: %s]\n", r.Title, r.Status)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\tDURATION\tERROR")
+	for _, step := range r.Steps {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", step.Name, step.Status, step.Duration, step.Error)
+	}
+	fmt.Fprintf(w, "total\t\t%s\t\n", r.Duration)
+	w.Flush()
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+)
+
+func setClipboard(text string) error {
+	cmd := exec.Command("pbcopy")
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
@@ -0,0 +1,35 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func setClipboard(text string) error {
+	var cmd *exec.Cmd
+	switch {
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		if text == "" {
+			return exec.Command("wl-copy", "--clear").Run()
+		}
+		cmd = exec.Command("wl-copy")
+	case hasCommand("xclip"):
+		cmd = exec.Command("xclip", "-selection", "clipboard")
+	case hasCommand("xsel"):
+		cmd = exec.Command("xsel", "--clipboard", "--input")
+	default:
+		return errors.New("no clipboard tool found, install wl-clipboard, xclip or xsel")
+	}
+
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
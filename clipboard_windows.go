@@ -0,0 +1,17 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+func setClipboard(text string) error {
+	script := "Set-Clipboard -Value $env:SAFEWORK_CLIPBOARD"
+	if text == "" {
+		script = "Add-Type -AssemblyName System.Windows.Forms; [System.Windows.Forms.Clipboard]::Clear()"
+	}
+
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-STA", "-Command", script)
+	cmd.Env = append(os.Environ(), "SAFEWORK_CLIPBOARD="+text)
+	return cmd.Run()
+}
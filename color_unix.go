@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+func enableColor(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0 && os.Getenv("TERM") != "dumb"
+}
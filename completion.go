@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+var (
+	completionCommands = []string{
+		"start", "resume", "stop", "status", "ps", "reload", "run", "trigger", "tui",
+		"logs", "serve", "service", "systemd", "launchd", "autostart", "version", "completion",
+	}
+
+	// words for the argument after a subcommand
+	completionWords = map[string]string{
+		"service":    "install uninstall run",
+		"systemd":    "install",
+		"launchd":    "install",
+		"autostart":  "enable disable",
+		"completion": "bash zsh fish powershell",
+	}
+
+	// names read from the config by `safework __complete`
+	completionNames = map[string]string{
+		"run":     "tasks",
+		"trigger": "actions",
+		"logs":    "processes",
+	}
+)
+
+// runCompletion prints a completion script for the shell. Task, action and
+// process names are not baked in, the script asks safework for them so
+// they follow the config.
+func runCompletion(args []string) int {
+	if len(args) != 1 {
+		fmt.Println("usage: safework completion bash|zsh|fish|powershell")
+		return 2
+	}
+
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion())
+	case "zsh":
+		fmt.Print(zshCompletion())
+	case "fish":
+		fmt.Print(fishCompletion())
+	case "powershell":
+		fmt.Print(powershellCompletion())
+	default:
+		fmt.Printf("ERR: unknown shell %s, use bash, zsh, fish or powershell\n", args[0])
+		return 2
+	}
+	return 0
+}
+
+// runCompleteNames prints the task, action or process names of the config
+// in dir, one per line. It is quiet on errors, which would only end up in
+// the completions.
+func runCompleteNames(args []string) int {
+	if len(args) < 1 || len(args) > 2 {
+		return 2
+	}
+	dir := ""
+	if len(args) > 1 {
+		dir = args[1]
+	}
+
+	var names []string
+	switch args[0] {
+	case "tasks":
+		if loadConfig(dir) != nil {
+			return 1
+		}
+		for name := range config().Tasks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		names = append(names, "startup", "cleanup")
+	case "actions":
+		for name := range hotKeyActions() {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	case "processes":
+		if loadConfig(dir) != nil {
+			return 1
+		}
+		files, _ := ioutil.ReadDir(processLogsDir())
+		for _, fi := range files {
+			if !fi.IsDir() && strings.HasSuffix(fi.Name(), ".log") {
+				names = append(names, strings.TrimSuffix(fi.Name(), ".log"))
+			}
+		}
+	default:
+		return 2
+	}
+
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return 0
+}
+
+func completionKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func bashCompletion() string {
+	var cases strings.Builder
+	for _, cmd := range completionKeys(completionWords) {
+		fmt.Fprintf(&cases, "\t%s)\n\t\tif ((COMP_CWORD == 2)); then\n\t\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n\t\t\treturn\n\t\tfi\n\t\t;;\n",
+			cmd, completionWords[cmd])
+	}
+	for _, cmd := range completionKeys(completionNames) {
+		fmt.Fprintf(&cases, "\t%s)\n\t\tif ((COMP_CWORD == 2)); then\n\t\t\tCOMPREPLY=($(compgen -W \"$(safework __complete %s \"$dir\" 2>/dev/null)\" -- \"$cur\"))\n\t\t\treturn\n\t\tfi\n\t\t;;\n",
+			cmd, completionNames[cmd])
+	}
+
+	return fmt.Sprintf(`# bash completion for safework
+# source <(safework completion bash)
+
+_safework() {
+	local cur=${COMP_WORDS[COMP_CWORD]} dir= i
+	for ((i = 2; i < COMP_CWORD; i++)); do
+		[[ -d ${COMP_WORDS[i]} ]] && dir=${COMP_WORDS[i]}
+	done
+
+	if ((COMP_CWORD == 1)); then
+		COMPREPLY=($(compgen -W %q -- "$cur"))
+		return
+	fi
+	case ${COMP_WORDS[1]} in
+%s	esac
+	COMPREPLY=($(compgen -d -- "$cur"))
+}
+
+complete -F _safework safework
+`, strings.Join(completionCommands, " "), cases.String())
+}
+
+func zshCompletion() string {
+	var cases strings.Builder
+	for _, cmd := range completionKeys(completionWords) {
+		fmt.Fprintf(&cases, "\t%s)\n\t\tif ((CURRENT == 3)); then\n\t\t\tcompadd -- %s\n\t\t\treturn\n\t\tfi\n\t\t;;\n",
+			cmd, completionWords[cmd])
+	}
+	for _, cmd := range completionKeys(completionNames) {
+		fmt.Fprintf(&cases, "\t%s)\n\t\tif ((CURRENT == 3)); then\n\t\t\tcompadd -- ${(f)\"$(safework __complete %s \"$dir\" 2>/dev/null)\"}\n\t\t\treturn\n\t\tfi\n\t\t;;\n",
+			cmd, completionNames[cmd])
+	}
+
+	return fmt.Sprintf(`#compdef safework
+# zsh completion for safework
+# source <(safework completion zsh)
+
+_safework() {
+	local dir= w
+	for w in ${words[3,CURRENT-1]}; do
+		[[ -d $w ]] && dir=$w
+	done
+
+	if ((CURRENT == 2)); then
+		compadd -- %s
+		return
+	fi
+	case $words[2] in
+%s	esac
+	_directories
+}
+
+compdef _safework safework
+`, strings.Join(completionCommands, " "), cases.String())
+}
+
+func fishCompletion() string {
+	var b strings.Builder
+	b.WriteString(`# fish completion for safework
+# safework completion fish | source
+
+function __safework_names
+	set -l dir
+	for w in (commandline -opc)[3..-1]
+		if test -d "$w"
+			set dir $w
+		end
+	end
+	safework __complete $argv[1] "$dir" 2>/dev/null
+end
+
+function __safework_arg
+	set -l words (commandline -opc)
+	test (count $words) -eq 2; and test "$words[2]" = $argv[1]
+end
+
+complete -c safework -f
+`)
+	fmt.Fprintf(&b, "complete -c safework -n __fish_use_subcommand -a %q\n", strings.Join(completionCommands, " "))
+	for _, cmd := range completionKeys(completionWords) {
+		fmt.Fprintf(&b, "complete -c safework -n \"__safework_arg %s\" -a %q\n", cmd, completionWords[cmd])
+	}
+	for _, cmd := range completionKeys(completionNames) {
+		fmt.Fprintf(&b, "complete -c safework -n \"__safework_arg %s\" -a \"(__safework_names %s)\"\n", cmd, completionNames[cmd])
+	}
+	b.WriteString("complete -c safework -n \"not __fish_use_subcommand\" -a \"(__fish_complete_directories)\"\n")
+	return b.String()
+}
+
+func powershellCompletion() string {
+	quote := func(words []string) string {
+		return "'" + strings.Join(words, "', '") + "'"
+	}
+
+	var cases strings.Builder
+	for _, cmd := range completionKeys(completionWords) {
+		fmt.Fprintf(&cases, "\t\t\t'%s' { $candidates = @(%s) }\n", cmd, quote(strings.Fields(completionWords[cmd])))
+	}
+	for _, cmd := range completionKeys(completionNames) {
+		fmt.Fprintf(&cases, "\t\t\t'%s' { $candidates = @(safework __complete %s $dir 2>$null) }\n", cmd, completionNames[cmd])
+	}
+
+	return fmt.Sprintf(`# powershell completion for safework
+# safework completion powershell | Out-String | Invoke-Expression
+
+Register-ArgumentCompleter -Native -CommandName safework -ScriptBlock {
+	param($wordToComplete, $commandAst, $cursorPosition)
+
+	$words = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })
+	if ($wordToComplete -eq '') {
+		$words += ''
+	}
+	$pos = $words.Count - 1
+	$dir = ''
+	for ($i = 2; $i -lt $pos; $i++) {
+		if (Test-Path -PathType Container $words[$i]) {
+			$dir = $words[$i]
+		}
+	}
+
+	$candidates = @()
+	if ($pos -eq 1) {
+		$candidates = @(%s)
+	} elseif ($pos -eq 2) {
+		switch ($words[1]) {
+%s		}
+	}
+	# nothing found falls back to paths
+	$candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+		[System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+	}
+}
+`, quote(completionCommands), cases.String())
+}
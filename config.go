@@ -0,0 +1,22 @@
+package main
+
+import "sync"
+
+var (
+	// globalCfg is swapped by a reload while the scheduler, triggers and
+	// remote handlers read it, read it through config()
+	configMutex sync.RWMutex
+	globalCfg   *Config
+)
+
+func config() *Config {
+	configMutex.RLock()
+	defer configMutex.RUnlock()
+	return globalCfg
+}
+
+func setConfig(cfg *Config) {
+	configMutex.Lock()
+	globalCfg = cfg
+	configMutex.Unlock()
+}
@@ -0,0 +1,6 @@
+//go:build !windows
+
+package main
+
+// handleConsoleClose is covered by SIGHUP outside Windows.
+func handleConsoleClose() {}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+const (
+	ctrlCloseEvent    = 2
+	ctrlLogoffEvent   = 5
+	ctrlShutdownEvent = 6
+)
+
+var procSetConsoleCtrlHandler = kernel32.NewProc("SetConsoleCtrlHandler")
+
+// handleConsoleClose runs cleanup when the console window is closed or
+// the session ends. Windows kills the process once the grace period is
+// over, so cleanup runs right in the handler.
+func handleConsoleClose() {
+	procSetConsoleCtrlHandler.Call(syscall.NewCallback(consoleCtrlHandler), 1)
+}
+
+func consoleCtrlHandler(event uintptr) uintptr {
+	names := map[uintptr]string{
+		ctrlCloseEvent:    "close",
+		ctrlLogoffEvent:   "logoff",
+		ctrlShutdownEvent: "shutdown",
+	}
+	name, ok := names[event]
+	if !ok {
+		// ctrl+c and ctrl+break go on to os/signal
+		return 0
+	}
+
+	// Windows allows 5s after a close and 20s after a logoff or shutdown,
+	// keep some of it to flush the log
+	grace := 3 * time.Second
+	if event != ctrlCloseEvent {
+		grace = 18 * time.Second
+	}
+	stopDeadline = time.Now().Add(grace)
+
+	logInfo("")
+	logWarn("[CONSOLE %s]", name)
+	code := exitOK
+	done := make(chan error, 1)
+	go func() { done <- cleanup() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			code = exitCleanup
+		}
+	case <-time.After(grace):
+		code = exitCleanup
+		logWarn("[CLEANUP TIMEOUT] %s, killing background processes", grace)
+		stopManagedProcesses()
+		// cleanup may be stopping some already, past the deadline it
+		// kills them right away
+		select {
+		case <-done:
+		case <-time.After(time.Second / 2):
+		}
+	}
+	exit(code)
+	return 1
+}
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	ControlConfig struct {
+		Port     int `json:"port"`
+		GRPCPort int `json:"grpc_port,omitempty"`
+
+		// Listen, Token and the TLS files expose the API beyond localhost.
+		// Token may reference environment variables like ${SAFEWORK_TOKEN}.
+		// Without one, a token is made per run and written to the file
+		// logged at startup, so web pages can't drive the API.
+		Listen  string `json:"listen,omitempty"`
+		Token   string `json:"token,omitempty"`
+		TLSCert string `json:"tls_cert,omitempty"`
+		TLSKey  string `json:"tls_key,omitempty"`
+	}
+
+	stepStatus struct {
+		Name     string `json:"name"`
+		Status   string `json:"status"`
+		Duration string `json:"duration"`
+		Error    string `json:"error,omitempty"`
+	}
+
+	reportStatus struct {
+		Title    string       `json:"title"`
+		Status   string       `json:"status"`
+		Start    time.Time    `json:"start"`
+		Duration string       `json:"duration"`
+		Error    string       `json:"error,omitempty"`
+		Steps    []stepStatus `json:"steps"`
+	}
+
+	processStatus struct {
+		ManagedProcess
+		Alive       bool `json:"alive"`
+		Restartable bool `json:"restartable"`
+	}
+
+	instanceStatus struct {
+		Startup   *reportStatus           `json:"startup"`
+		Tasks     map[string]reportStatus `json:"tasks"`
+		Processes []processStatus         `json:"processes"`
+	}
+)
+
+const maxHistory = 20
+
+var (
+	reportMutex   sync.Mutex
+	startupReport *RunReport
+	taskReports   = make(map[string]*RunReport)
+	reportHistory []*RunReport
+
+	//go:embed dashboard.html
+	dashboardHTML []byte
+
+	// controlToken is the bearer token of the running control api
+	controlToken string
+)
+
+// recordReport keeps the latest report of startup (task "") or a task.
+func recordReport(task string, r *RunReport) {
+	reportMutex.Lock()
+	defer reportMutex.Unlock()
+
+	if task == "" {
+		startupReport = r
+	} else {
+		taskReports[task] = r
+	}
+
+	reportHistory = append(reportHistory, r)
+	if len(reportHistory) > maxHistory {
+		reportHistory = reportHistory[1:]
+	}
+}
+
+func (r *RunReport) status() reportStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := reportStatus{Title: r.Title, Status: "running", Start: r.Start, Steps: []stepStatus{}}
+	end := time.Now()
+	if !r.End.IsZero() {
+		end, s.Status = r.End, "ok"
+	}
+	if r.Err != nil {
+		s.Status, s.Error = "failed", r.Err.Error()
+	}
+	s.Duration = end.Sub(r.Start).Round(time.Millisecond).String()
+
+	for _, step := range r.Steps {
+		d := step.Duration
+		if step.Status == "running" {
+			d = time.Since(step.Start)
+		}
+		st := stepStatus{Name: step.Name, Status: step.Status, Duration: d.Round(time.Millisecond).String()}
+		if step.Err != nil {
+			st.Error = step.Err.Error()
+		}
+		s.Steps = append(s.Steps, st)
+	}
+	return s
+}
+
+func startControlServer() error {
+	if config().Control == nil || config().Control.Port == 0 {
+		return nil
+	}
+
+	ctl := config().Control
+	host := ctl.Listen
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	token := os.ExpandEnv(ctl.Token)
+	useTLS := ctl.TLSCert != "" || ctl.TLSKey != ""
+
+	err := checkControlExposure(host, token, ctl)
+	if err != nil {
+		logError("ERR: control api: %s", err)
+		return err
+	}
+
+	tokenFile, err := setControlToken(token)
+	if err != nil {
+		logError("ERR: control api: %s", err)
+		return err
+	}
+
+	var cert tls.Certificate
+	if useTLS {
+		cert, err = tls.LoadX509KeyPair(ctl.TLSCert, ctl.TLSKey)
+		if err != nil {
+			logError("ERR: control api: %s", err)
+			return err
+		}
+	}
+
+	addr := net.JoinHostPort(host, strconv.Itoa(ctl.Port))
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		logError("ERR: control api: %s", err)
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handleDashboard)
+	mux.HandleFunc("/status", handleStatus)
+	mux.HandleFunc("/history", handleHistory)
+	mux.HandleFunc("/processes", handleProcesses)
+	mux.HandleFunc("/processes/", handleProcesses)
+	mux.HandleFunc("/startup", handleStartup)
+	mux.HandleFunc("/cleanup", handleCleanup)
+	mux.HandleFunc("/tasks", handleTasks)
+	mux.HandleFunc("/tasks/", handleTasks)
+	mux.HandleFunc("/events", handleEvents)
+	mux.HandleFunc("/trigger/", handleTrigger)
+	mux.HandleFunc("/webhooks/", handleWebhook)
+	mux.HandleFunc("/metrics", handleMetrics)
+	mux.HandleFunc("/healthz", handleHealthz)
+
+	handler := checkOrigin(host, requireToken(mux))
+
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+		ln = tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+	}
+	logInfo("control api: %s://%s", scheme, addr)
+	if tokenFile != "" {
+		logInfo("control api token: %s", tokenFile)
+	}
+	go http.Serve(ln, handler)
+	return nil
+}
+
+// setControlToken sets the token the control and grpc apis require. Without
+// a configured one, a token is made once per run and written to its file,
+// which is returned the first time only.
+func setControlToken(token string) (string, error) {
+	if controlToken != "" {
+		return "", nil
+	}
+	tokenFile := ""
+	if token == "" {
+		token = randomID(16)
+		tokenFile = controlTokenPath(configDir)
+		err := writeTokenFile(tokenFile, token)
+		if err != nil {
+			return "", err
+		}
+	}
+	controlToken = token
+	return tokenFile, nil
+}
+
+// controlTokenPath is where the generated token of the instance running
+// the config in dir is kept, in the per-user runtime dir if there is one.
+func controlTokenPath(dir string) string {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = os.TempDir()
+	}
+	return filepath.Join(runtimeDir, instanceID(dir)+".token")
+}
+
+// writeTokenFile makes a new file for the token. Writing over the old one
+// would keep its owner and mode, and in a shared temp dir anybody could
+// have made it.
+func writeTokenFile(name, token string) error {
+	err := os.Remove(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(token + "\n")
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// checkControlExposure refuses to serve beyond loopback without both a
+// token and TLS.
+func checkControlExposure(host, token string, ctl *ControlConfig) error {
+	if (ctl.TLSCert == "") != (ctl.TLSKey == "") {
+		return errors.New("tls_cert and tls_key must be set together")
+	}
+
+	ip := net.ParseIP(host)
+	if host == "localhost" || ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	if token == "" {
+		return fmt.Errorf("refuse to listen on %s without a token", host)
+	}
+	if ctl.TLSCert == "" {
+		return fmt.Errorf("refuse to listen on %s without tls_cert and tls_key", host)
+	}
+	return nil
+}
+
+func controlTokenValid(r *http.Request) bool {
+	got := []byte(r.Header.Get("Authorization"))
+	return controlToken != "" && subtle.ConstantTimeCompare(got, []byte("Bearer "+controlToken)) == 1
+}
+
+// requireToken guards everything except webhooks, which senders like
+// GitHub sign instead of sending a bearer token, and the dashboard page,
+// which holds no data and asks for the token itself.
+func requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" && r.Method == http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/webhooks/") && !controlTokenValid(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkOrigin turns away what a web page could send: a Host other than the
+// listen address, as after DNS rebinding, a foreign Origin, and a
+// state-changing request a plain form could make. Webhooks come through
+// proxies from other sites and are checked by their signature instead.
+func checkOrigin(host string, next http.Handler) http.Handler {
+	ip := net.ParseIP(host)
+	loopback := host == "localhost" || ip != nil && ip.IsLoopback()
+	wildcard := ip != nil && ip.IsUnspecified()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/webhooks/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		reqHost := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			reqHost = h
+		}
+		reqHost = strings.Trim(reqHost, "[]")
+		reqIP := net.ParseIP(reqHost)
+		hostOK := wildcard || strings.EqualFold(reqHost, host) ||
+			loopback && (reqHost == "localhost" || reqIP != nil && reqIP.IsLoopback())
+		if !hostOK {
+			writeError(w, http.StatusForbidden, fmt.Errorf("unexpected host %s", r.Host))
+			return
+		}
+
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || u.Host != r.Host {
+				writeError(w, http.StatusForbidden, fmt.Errorf("cross-origin request from %s", origin))
+				return
+			}
+		}
+
+		// forms can't set either header
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Header.Get("Authorization") == "" &&
+			!strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			writeError(w, http.StatusUnsupportedMediaType, errors.New("use Content-Type: application/json"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func requireMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("use %s", method))
+	return false
+}
+
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, currentStatus())
+}
+
+func currentStatus() instanceStatus {
+	status := instanceStatus{Tasks: make(map[string]reportStatus), Processes: []processStatus{}}
+
+	reportMutex.Lock()
+	if startupReport != nil {
+		s := startupReport.status()
+		status.Startup = &s
+	}
+	for name, report := range taskReports {
+		status.Tasks[name] = report.status()
+	}
+	reportMutex.Unlock()
+
+	for _, p := range managedProcesses() {
+		status.Processes = append(status.Processes, processStatus{p, processAlive(p.Pid), p.cli != nil})
+	}
+	return status
+}
+
+func handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardHTML)
+}
+
+// handleHistory lists the recent startup and task runs, newest first.
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	reportMutex.Lock()
+	history := make([]reportStatus, 0, len(reportHistory))
+	for i := len(reportHistory) - 1; i >= 0; i-- {
+		history = append(history, reportHistory[i].status())
+	}
+	reportMutex.Unlock()
+
+	writeJSON(w, http.StatusOK, history)
+}
+
+// handleProcesses lists managed processes on GET /processes and restarts
+// a background command on POST /processes/<pid>/restart.
+func handleProcesses(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/processes"), "/")
+	if path == "" {
+		if !requireMethod(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, http.StatusOK, currentStatus().Processes)
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	pid, err := strconv.Atoi(parts[0])
+	if len(parts) != 2 || parts[1] != "restart" || err != nil {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	err = restartManagedProcess(pid)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleTrigger runs hotkey actions, e.g. POST /trigger/hide_apps,cleanup.
+func handleTrigger(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	names := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/trigger/"), "/"), ",")
+	err := triggerActions("http", names)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "triggered"})
+}
+
+// handleHealthz answers 200 once startup has succeeded and every managed
+// process is alive, and 503 otherwise.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	health := struct {
+		Healthy   bool            `json:"healthy"`
+		Startup   string          `json:"startup"`
+		Processes []processStatus `json:"processes"`
+	}{Startup: "pending", Processes: []processStatus{}}
+
+	reportMutex.Lock()
+	if startupReport != nil {
+		health.Startup = startupReport.status().Status
+	}
+	reportMutex.Unlock()
+
+	health.Healthy = health.Startup == "ok"
+	for _, p := range managedProcesses() {
+		ps := processStatus{p, processAlive(p.Pid), p.cli != nil}
+		health.Healthy = health.Healthy && ps.Alive
+		health.Processes = append(health.Processes, ps)
+	}
+
+	code := http.StatusOK
+	if !health.Healthy {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, health)
+}
+
+func handleStartup(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	report, err := runStartup()
+	if err != nil {
+		rollback(report)
+		writeJSON(w, http.StatusInternalServerError, report.status())
+		return
+	}
+	writeJSON(w, http.StatusOK, report.status())
+}
+
+func handleCleanup(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	err := cleanup()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"status": "failed", "error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleTasks lists tasks on GET /tasks and runs one on POST /tasks/<name>.
+func handleTasks(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/tasks"), "/")
+	if name == "" {
+		if !requireMethod(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, http.StatusOK, taskNames())
+		return
+	}
+
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+	if _, ok := config().Tasks[name]; !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown task %s", name))
+		return
+	}
+
+	report, err := runTask(name)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, report.status())
+		return
+	}
+	writeJSON(w, http.StatusOK, report.status())
+}
+
+// handleEvents streams events as server-sent events until the client leaves.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+
+	events, cancel := subscribeEvents()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-events:
+			b, _ := json.Marshal(e)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b)
+			flusher.Flush()
+		}
+	}
+}
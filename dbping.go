@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+func checkDatabaseDSN(dsn string) error {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return err
+	}
+
+	switch u.Scheme {
+	case "postgres", "postgresql", "mysql", "redis":
+		return nil
+	default:
+		return fmt.Errorf("unsupported database %s", u.Scheme)
+	}
+}
+
+func pingDatabase(dsn string) error {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return err
+	}
+
+	switch u.Scheme {
+	case "postgres", "postgresql":
+		return pingPostgres(u)
+	case "mysql":
+		return pingMySQL(u)
+	case "redis":
+		return pingRedis(u)
+	default:
+		return fmt.Errorf("unsupported database %s", u.Scheme)
+	}
+}
+
+func dialDatabase(u *url.URL, defaultPort string) (net.Conn, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+
+	conn, err := net.DialTimeout("tcp", host, 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+	return conn, nil
+}
+
+// pingPostgres behaves like pg_isready: any reply other than
+// "the database system is starting up" means the server accepts queries.
+func pingPostgres(u *url.URL) error {
+	conn, err := dialDatabase(u, "5432")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	user := u.User.Username()
+	if user == "" {
+		user = "postgres"
+	}
+	db := strings.TrimPrefix(u.Path, "/")
+	if db == "" {
+		db = user
+	}
+
+	body := new(bytes.Buffer)
+	binary.Write(body, binary.BigEndian, int32(196608))
+	for _, s := range []string{"user", user, "database", db} {
+		body.WriteString(s)
+		body.WriteByte(0)
+	}
+	body.WriteByte(0)
+
+	msg := new(bytes.Buffer)
+	binary.Write(msg, binary.BigEndian, int32(body.Len()+4))
+	msg.Write(body.Bytes())
+	_, err = conn.Write(msg.Bytes())
+	if err != nil {
+		return err
+	}
+
+	var head [5]byte
+	_, err = io.ReadFull(conn, head[:])
+	if err != nil {
+		return err
+	}
+
+	switch head[0] {
+	case 'R':
+		return nil
+	case 'E':
+		n := int(binary.BigEndian.Uint32(head[1:])) - 4
+		if n < 0 || n > 1<<16 {
+			return errors.New("invalid postgres reply")
+		}
+		payload := make([]byte, n)
+		_, err = io.ReadFull(conn, payload)
+		if err != nil {
+			return err
+		}
+		for _, field := range bytes.Split(payload, []byte{0}) {
+			if len(field) > 0 && field[0] == 'C' && string(field[1:]) == "57P03" {
+				return errors.New("postgres is starting up")
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unexpected postgres reply %q", head[0])
+	}
+}
+
+func pingMySQL(u *url.URL) error {
+	conn, err := dialDatabase(u, "3306")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var head [5]byte
+	_, err = io.ReadFull(conn, head[:])
+	if err != nil {
+		return err
+	}
+
+	switch head[4] {
+	case 0x0a:
+		return nil
+	case 0xff:
+		return errors.New("mysql refused connection")
+	default:
+		return fmt.Errorf("unexpected mysql handshake %#x", head[4])
+	}
+}
+
+func pingRedis(u *url.URL) error {
+	conn, err := dialDatabase(u, "6379")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	if password, ok := u.User.Password(); ok {
+		_, err = fmt.Fprintf(conn, "*2\r\n$4\r\nAUTH\r\n$%d\r\n%s\r\n", len(password), password)
+		if err != nil {
+			return err
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, "+OK") {
+			return fmt.Errorf("redis auth failed, %s", strings.TrimSpace(line))
+		}
+	}
+
+	_, err = conn.Write([]byte("PING\r\n"))
+	if err != nil {
+		return err
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	// NOAUTH still proves redis is serving commands
+	if strings.HasPrefix(line, "+PONG") || strings.HasPrefix(line, "-NOAUTH") {
+		return nil
+	}
+	return fmt.Errorf("redis not ready, %s", strings.TrimSpace(line))
+}
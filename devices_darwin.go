@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ioregVendorRegex  = regexp.MustCompile(`"idVendor" = (\d+)`)
+	ioregProductRegex = regexp.MustCompile(`"idProduct" = (\d+)`)
+)
+
+// listDevices returns the VID:PID of attached USB devices and the labels
+// of mounted volumes.
+func listDevices() (map[string]bool, error) {
+	out, err := exec.Command("ioreg", "-p", "IOUSB", "-l", "-w0").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	devices := map[string]bool{}
+	for _, entry := range strings.Split(string(out), "+-o ") {
+		vid := ioregVendorRegex.FindStringSubmatch(entry)
+		pid := ioregProductRegex.FindStringSubmatch(entry)
+		if vid == nil || pid == nil {
+			continue
+		}
+		v, _ := strconv.Atoi(vid[1])
+		p, _ := strconv.Atoi(pid[1])
+		devices[fmt.Sprintf("%04x:%04x", v, p)] = true
+	}
+
+	volumes, err := ioutil.ReadDir("/Volumes")
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range volumes {
+		devices[v.Name()] = true
+	}
+	return devices, nil
+}
@@ -0,0 +1,58 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// listDevices returns the VID:PID of attached USB devices and the labels
+// of attached volumes.
+func listDevices() (map[string]bool, error) {
+	devices := map[string]bool{}
+
+	dirs, err := filepath.Glob("/sys/bus/usb/devices/*")
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		vid, err := ioutil.ReadFile(filepath.Join(dir, "idVendor"))
+		if err != nil {
+			continue
+		}
+		pid, err := ioutil.ReadFile(filepath.Join(dir, "idProduct"))
+		if err != nil {
+			continue
+		}
+		devices[strings.TrimSpace(string(vid))+":"+strings.TrimSpace(string(pid))] = true
+	}
+
+	labels, err := ioutil.ReadDir("/dev/disk/by-label")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, label := range labels {
+		devices[unescapeLabel(label.Name())] = true
+	}
+	return devices, nil
+}
+
+// unescapeLabel decodes udev's \x20 style escapes.
+func unescapeLabel(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' {
+			if c, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
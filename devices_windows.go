@@ -0,0 +1,85 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	digcfPresent     = 0x2
+	digcfAllClasses  = 0x4
+	invalidHandle    = ^uintptr(0)
+	semFailCritical  = 0x1
+	maxVolumeNameLen = 261
+)
+
+var (
+	setupapi                         = syscall.NewLazyDLL("setupapi.dll")
+	procSetupDiGetClassDevsW         = setupapi.NewProc("SetupDiGetClassDevsW")
+	procSetupDiEnumDeviceInfo        = setupapi.NewProc("SetupDiEnumDeviceInfo")
+	procSetupDiGetDeviceInstanceIdW  = setupapi.NewProc("SetupDiGetDeviceInstanceIdW")
+	procSetupDiDestroyDeviceInfoList = setupapi.NewProc("SetupDiDestroyDeviceInfoList")
+
+	kernel32                  = syscall.NewLazyDLL("kernel32.dll")
+	procGetLogicalDrives      = kernel32.NewProc("GetLogicalDrives")
+	procGetVolumeInformationW = kernel32.NewProc("GetVolumeInformationW")
+	procSetErrorMode          = kernel32.NewProc("SetErrorMode")
+
+	usbIDRegex = regexp.MustCompile(`VID_([0-9A-F]{4})&PID_([0-9A-F]{4})`)
+)
+
+type spDevinfoData struct {
+	Size      uint32
+	ClassGUID [16]byte
+	DevInst   uint32
+	Reserved  uintptr
+}
+
+// listDevices returns the VID:PID of present USB devices and the labels
+// of mounted volumes.
+func listDevices() (map[string]bool, error) {
+	devices := map[string]bool{}
+
+	enumerator, _ := syscall.UTF16PtrFromString("USB")
+	set, _, err := procSetupDiGetClassDevsW.Call(0, uintptr(unsafe.Pointer(enumerator)), 0, digcfPresent|digcfAllClasses)
+	if set == invalidHandle {
+		return nil, err
+	}
+	defer procSetupDiDestroyDeviceInfoList.Call(set)
+
+	for i := 0; ; i++ {
+		data := spDevinfoData{}
+		data.Size = uint32(unsafe.Sizeof(data))
+		ret, _, _ := procSetupDiEnumDeviceInfo.Call(set, uintptr(i), uintptr(unsafe.Pointer(&data)))
+		if ret == 0 {
+			break
+		}
+
+		buf := make([]uint16, 512)
+		ret, _, _ = procSetupDiGetDeviceInstanceIdW.Call(set, uintptr(unsafe.Pointer(&data)), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0)
+		if ret == 0 {
+			continue
+		}
+		if m := usbIDRegex.FindStringSubmatch(strings.ToUpper(syscall.UTF16ToString(buf))); m != nil {
+			devices[strings.ToLower(m[1]+":"+m[2])] = true
+		}
+	}
+
+	// don't let empty card readers pop up "insert a disk" dialogs
+	procSetErrorMode.Call(semFailCritical)
+	drives, _, _ := procGetLogicalDrives.Call()
+	for i := 0; i < 26; i++ {
+		if drives&(1<<uint(i)) == 0 {
+			continue
+		}
+		root, _ := syscall.UTF16PtrFromString(string(rune('A'+i)) + `:\`)
+		label := make([]uint16, maxVolumeNameLen)
+		ret, _, _ := procGetVolumeInformationW.Call(uintptr(unsafe.Pointer(root)), uintptr(unsafe.Pointer(&label[0])), uintptr(len(label)), 0, 0, 0, 0, 0)
+		if ret != 0 && label[0] != 0 {
+			devices[syscall.UTF16ToString(label)] = true
+		}
+	}
+	return devices, nil
+}
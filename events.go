@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is a progress notification for streaming clients. Types are
+// started, output, finished, hotkey and log.
+type Event struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	Name       string    `json:"name,omitempty"`
+	Stream     string    `json:"stream,omitempty"`
+	Text       string    `json:"text,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms,omitempty"`
+}
+
+var (
+	eventMutex sync.Mutex
+	eventSubs  = make(map[chan Event]bool)
+)
+
+func publishEvent(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	eventMutex.Lock()
+	defer eventMutex.Unlock()
+	for ch := range eventSubs {
+		select {
+		case ch <- e:
+		default:
+			// a slow client misses events rather than blocking commands
+		}
+	}
+}
+
+func subscribeEvents() (<-chan Event, func()) {
+	ch := make(chan Event, 256)
+	eventMutex.Lock()
+	eventSubs[ch] = true
+	eventMutex.Unlock()
+
+	return ch, func() {
+		eventMutex.Lock()
+		delete(eventSubs, ch)
+		eventMutex.Unlock()
+	}
+}
+
+func publishFinished(name string, d time.Duration, err error) {
+	e := Event{Type: "finished", Name: name, Status: "ok", DurationMs: d.Milliseconds()}
+	if err == errSkipped {
+		e.Status = "skipped"
+	} else if err != nil {
+		e.Status, e.Error = "failed", err.Error()
+	}
+	publishEvent(e)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func runMacroCopy(ctx context.Context, cli CommandLine) error {
+	return copyOrMove(cli, false)
+}
+
+func runMacroMove(ctx context.Context, cli CommandLine) error {
+	return copyOrMove(cli, true)
+}
+
+func runMacroDelete(ctx context.Context, cli CommandLine) error {
+	if len(cli.Args) == 0 {
+		return errors.New("!DELETE requires at least one path")
+	}
+
+	for _, pattern := range cli.Args {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		for _, name := range matches {
+			logFor(cli).Info("delete: %s", name)
+			err = os.RemoveAll(name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func copyOrMove(cli CommandLine, move bool) error {
+	if len(cli.Args) < 2 {
+		return fmt.Errorf("%s requires source(s) and a destination", cli.Command)
+	}
+
+	dst := cli.Args[len(cli.Args)-1]
+	if dst == "" {
+		return fmt.Errorf("%s: empty destination", cli.Command)
+	}
+	var srcs []string
+	for _, pattern := range cli.Args[:len(cli.Args)-1] {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("no such file %s", pattern)
+		}
+		srcs = append(srcs, matches...)
+	}
+
+	intoDir := len(srcs) > 1 || os.IsPathSeparator(dst[len(dst)-1])
+	if fi, err := os.Stat(dst); err == nil && fi.IsDir() {
+		intoDir = true
+	}
+	if intoDir {
+		err := os.MkdirAll(dst, 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, src := range srcs {
+		target := dst
+		if intoDir {
+			target = filepath.Join(dst, filepath.Base(src))
+		}
+
+		var err error
+		if move {
+			logFor(cli).Info("move: %s -> %s", src, target)
+			err = movePath(src, target)
+		} else {
+			logFor(cli).Info("copy: %s -> %s", src, target)
+			err = copyPath(src, target)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func movePath(src, dst string) error {
+	if os.Rename(src, dst) == nil {
+		return nil
+	}
+
+	// rename fails across volumes, fall back to copy and delete
+	err := copyPath(src, dst)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+func copyPath(src, dst string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return copyFile(src, dst, fi.Mode())
+	}
+
+	return filepath.Walk(src, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if fi.IsDir() {
+			return os.MkdirAll(target, fi.Mode().Perm()|0700)
+		}
+		return copyFile(name, target, fi.Mode())
+	})
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func runMacroMkdir(ctx context.Context, cli CommandLine) error {
+	if len(cli.Args) == 0 {
+		return errors.New("!MKDIR requires at least one directory")
+	}
+
+	for _, dir := range cli.Args {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runMacroCleanDir(ctx context.Context, cli CommandLine) error {
+	if len(cli.Args) == 0 {
+		return errors.New("!CLEAN_DIR requires at least one directory")
+	}
+
+	for _, dir := range cli.Args {
+		err := checkCleanRoot(dir)
+		if err != nil {
+			return err
+		}
+
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			return err
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			err = os.RemoveAll(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return err
+			}
+		}
+		logFor(cli).Info("clean: %s (%d entries)", dir, len(entries))
+	}
+	return nil
+}
+
+// checkCleanRoot allows dir if it resolves, symlinks and all, into one of
+// clean_roots. Relative roots are taken from the config dir.
+func checkCleanRoot(dir string) error {
+	abs, err := resolvePath(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, root := range config().CleanRoots {
+		if !filepath.IsAbs(root) {
+			root = filepath.Join(configDir, root)
+		}
+		root, err = resolvePath(root)
+		if err != nil {
+			return err
+		}
+		if filepath.Dir(root) == root {
+			// never treat a volume root as an allowed root
+			continue
+		}
+
+		rel, err := filepath.Rel(root, abs)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("refuse to clean %s, it is outside clean_roots", dir)
+}
+
+// resolvePath makes name absolute and resolves its symlinks. A part that
+// doesn't exist yet is kept as written below its deepest existing parent.
+func resolvePath(name string) (string, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+
+	rest := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(abs)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		if !os.IsNotExist(err) || filepath.Dir(abs) == abs {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(abs), rest)
+		abs = filepath.Dir(abs)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckCleanRoot(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "root")
+	outside := filepath.Join(tmp, "outside")
+	for _, dir := range []string{filepath.Join(root, "cache"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skip(err)
+	}
+
+	oldDir := configDir
+	defer func() { configDir = oldDir }()
+	configDir = tmp
+
+	for _, roots := range [][]string{{root}, {"root"}} {
+		setConfig(&Config{CleanRoots: roots})
+		tests := []struct {
+			dir string
+			ok  bool
+		}{
+			{filepath.Join(root, "cache"), true},
+			{filepath.Join(root, "new", "dir"), true},
+			{filepath.Join(root, "link"), false},
+			{filepath.Join(root, "link", "sub"), false},
+			{filepath.Join(root, ".."), false},
+			{outside, false},
+		}
+		for _, tt := range tests {
+			err := checkCleanRoot(tt.dir)
+			if (err == nil) != tt.ok {
+				t.Errorf("roots %q, %s: got %v", roots, tt.dir, err)
+			}
+		}
+	}
+	setConfig(&Config{})
+}
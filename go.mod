@@ -3,11 +3,19 @@ module safework
 go 1.18
 
 require (
+	fyne.io/systray v1.10.0
+	github.com/godbus/dbus/v5 v5.1.0
 	golang.design/x/hotkey v0.3.0
-	golang.org/x/text v0.3.7
+	golang.org/x/sys v0.7.0
+	golang.org/x/text v0.9.0
+	google.golang.org/grpc v1.56.3
+	google.golang.org/protobuf v1.30.0
 )
 
 require (
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/tevino/abool v1.2.0 // indirect
 	golang.design/x/mainthread v0.3.0 // indirect
-	golang.org/x/sys v0.0.0-20210630005230-0f9fa26af87c // indirect
+	golang.org/x/net v0.9.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
 )
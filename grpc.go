@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"safework/api"
+)
+
+type grpcServer struct {
+	api.UnimplementedSafeWorkServer
+}
+
+func startGRPCServer() error {
+	if config().Control == nil || config().Control.GRPCPort == 0 {
+		return nil
+	}
+
+	addr := fmt.Sprintf("127.0.0.1:%d", config().Control.GRPCPort)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		logError("ERR: grpc api: %s", err)
+		return err
+	}
+
+	err = startLogTee()
+	if err != nil {
+		ln.Close()
+		logError("ERR: grpc api: %s", err)
+		return err
+	}
+
+	tokenFile, err := setControlToken(os.ExpandEnv(config().Control.Token))
+	if err != nil {
+		ln.Close()
+		logError("ERR: grpc api: %s", err)
+		return err
+	}
+
+	logInfo("grpc api: %s", addr)
+	if tokenFile != "" {
+		logInfo("grpc api token: %s", tokenFile)
+	}
+	go newGRPCServer().Serve(ln)
+	return nil
+}
+
+// newGRPCServer requires the control api token on every call, sent as
+// "authorization: Bearer <token>" metadata.
+func newGRPCServer() *grpc.Server {
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := checkGRPCToken(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := checkGRPCToken(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	)
+	api.RegisterSafeWorkServer(s, grpcServer{})
+	return s
+}
+
+func checkGRPCToken(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, got := range md.Get("authorization") {
+		if controlToken != "" && subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+controlToken)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "unauthorized")
+}
+
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func reportProto(r *RunReport) *api.Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := &api.Report{Title: r.Title, Status: "running", StartUnixMs: unixMillis(r.Start)}
+	end := time.Now()
+	if !r.End.IsZero() {
+		end, p.Status = r.End, "ok"
+	}
+	if r.Err != nil {
+		p.Status, p.Error = "failed", r.Err.Error()
+	}
+	p.DurationMs = end.Sub(r.Start).Milliseconds()
+
+	for _, step := range r.Steps {
+		s := &api.Step{Name: step.Name, Status: step.Status, DurationMs: step.Duration.Milliseconds()}
+		if step.Err != nil {
+			s.Error = step.Err.Error()
+		}
+		p.Steps = append(p.Steps, s)
+	}
+	return p
+}
+
+// RunTask reports a failing task in the reply status, not as an rpc error.
+func (grpcServer) RunTask(ctx context.Context, req *api.RunTaskRequest) (*api.Report, error) {
+	if _, ok := config().Tasks[req.Name]; !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown task %s", req.Name)
+	}
+
+	report, _ := runTask(req.Name)
+	return reportProto(report), nil
+}
+
+func (grpcServer) Status(ctx context.Context, req *api.StatusRequest) (*api.StatusReply, error) {
+	reply := &api.StatusReply{Tasks: make(map[string]*api.Report)}
+
+	reportMutex.Lock()
+	if startupReport != nil {
+		reply.Startup = reportProto(startupReport)
+	}
+	for name, report := range taskReports {
+		reply.Tasks[name] = reportProto(report)
+	}
+	reportMutex.Unlock()
+
+	for _, p := range managedProcesses() {
+		reply.Processes = append(reply.Processes, &api.Process{
+			Name:          p.Name,
+			Pid:           int32(p.Pid),
+			StartedUnixMs: unixMillis(p.Started),
+			Alive:         processAlive(p.Pid),
+		})
+	}
+	return reply, nil
+}
+
+func (grpcServer) StreamLogs(req *api.StreamLogsRequest, stream api.SafeWork_StreamLogsServer) error {
+	events, cancel := subscribeEvents()
+	defer cancel()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e := <-events:
+			if e.Type != "log" {
+				continue
+			}
+			err := stream.Send(&api.LogLine{TimeUnixMs: unixMillis(e.Time), Text: e.Text})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (grpcServer) Cleanup(ctx context.Context, req *api.CleanupRequest) (*api.CleanupReply, error) {
+	err := cleanup()
+	if req.Exit {
+		code := exitOK
+		if err != nil {
+			code = exitCleanup
+		}
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			exit(code)
+		}()
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &api.CleanupReply{}, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"safework/api"
+)
+
+func TestGRPCRequiresToken(t *testing.T) {
+	controlToken = "secret"
+	defer func() { controlToken = "" }()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newGRPCServer()
+	go s.Serve(ln)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := api.NewSafeWorkClient(conn)
+
+	for _, token := range []string{"", "Bearer wrong", "secret"} {
+		ctx := context.Background()
+		if token != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", token)
+		}
+		_, err = client.Status(ctx, &api.StatusRequest{})
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Status with %q: got %v, want Unauthenticated", token, err)
+		}
+
+		stream, err := client.StreamLogs(ctx, &api.StreamLogsRequest{})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("StreamLogs with %q: got %v, want Unauthenticated", token, err)
+		}
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+	_, err = client.Status(ctx, &api.StatusRequest{})
+	if err != nil {
+		t.Errorf("Status with token: %s", err)
+	}
+}
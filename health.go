@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"time"
+)
+
+// Probe checks a background command: Port must accept connections, HTTP
+// must answer with 2xx and Command must exit with 0. For readiness, Log
+// can instead wait for a line matching a regexp in the command's output.
+// Interval and Timeout are in seconds; Retries failures in a row count as
+// unhealthy.
+type Probe struct {
+	Port     string   `json:"port,omitempty"`
+	HTTP     string   `json:"http,omitempty"`
+	Command  []string `json:"command,omitempty"`
+	Log      string   `json:"log,omitempty"`
+	Interval int      `json:"interval,omitempty"`
+	Timeout  int      `json:"timeout,omitempty"`
+	Retries  int      `json:"retries,omitempty"`
+}
+
+func (p *Probe) check() error {
+	timeout := 5 * time.Second
+	if p.Timeout > 0 {
+		timeout = time.Duration(p.Timeout) * time.Second
+	}
+
+	switch {
+	case p.Port != "":
+		conn, err := net.DialTimeout("tcp", p.Port, timeout)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	case p.HTTP != "":
+		client := &http.Client{Timeout: timeout}
+		resp, err := client.Get(p.HTTP)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+	case len(p.Command) > 0:
+		cmd := exec.Command(p.Command[0], p.Command[1:]...)
+		err := cmd.Start()
+		if err != nil {
+			return err
+		}
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		select {
+		case err = <-done:
+			return err
+		case <-time.After(timeout):
+			cmd.Process.Kill()
+			return errors.New("timeout")
+		}
+	default:
+		return errors.New("probe needs a port, http or command")
+	}
+	return nil
+}
+
+// watchHealth checks a background command until it is no longer managed,
+// and restarts it after Retries failures in a row.
+func watchHealth(cli CommandLine, pid int) {
+	h := cli.Health
+	interval, retries := 30*time.Second, 3
+	if h.Interval > 0 {
+		interval = time.Duration(h.Interval) * time.Second
+	}
+	if h.Retries > 0 {
+		retries = h.Retries
+	}
+
+	name := commandName(cli)
+	failures := 0
+	for {
+		time.Sleep(interval)
+		if !isManaged(pid) {
+			return
+		}
+
+		err := h.check()
+		if err == nil {
+			failures = 0
+			continue
+		}
+		failures++
+		cmdLogger(name).Warn("health check failed: %s (pid %d), %s", name, pid, err)
+		if failures < retries {
+			continue
+		}
+
+		cmdLogger(name).Info("")
+		cmdLogger(name).Warn("[UNHEALTHY] %s (pid %d): %d checks failed", name, pid, failures)
+		publishEvent(Event{Type: "unhealthy", Name: name, Error: err.Error()})
+		if !allowRestart(cli) {
+			cmdLogger(name).Warn("[GAVE UP] %s (pid %d): %d restarts within %s", name, pid, cli.MaxRestarts, restartWindow(cli))
+			sendNotification("safework: "+name+" unhealthy", fmt.Sprintf("%s, too many restarts, giving up", err))
+			sendAlert("gave_up", "safework: "+name+" unhealthy", fmt.Sprintf("%s, too many restarts, giving up", err))
+			return
+		}
+		sendNotification("safework: "+name+" unhealthy", fmt.Sprintf("%s, restarting", err))
+		_, err = respawnProcess(pid)
+		if err != nil {
+			cmdLogger(name).Error("---> %s", err)
+			sendNotification("safework: "+name+" restart failed", err.Error())
+		}
+		// the new process gets its own watcher
+		return
+	}
+}
+
+// waitReady blocks until the probe of a just started background command
+// passes, for up to the command's timeout (default 60s). offset is where
+// its log ended before it started.
+func waitReady(ctx context.Context, cli CommandLine, pid int, offset int64) error {
+	p := cli.Ready
+	var re *regexp.Regexp
+	if p.Log != "" {
+		var err error
+		re, err = regexp.Compile(p.Log)
+		if err != nil {
+			return fmt.Errorf("ready log: %s", err)
+		}
+	}
+
+	interval, timeout := time.Second/2, time.Minute
+	if p.Interval > 0 {
+		interval = time.Duration(p.Interval) * time.Second
+	}
+	if cli.Timeout > 0 {
+		timeout = cli.Timeout * time.Second
+	}
+
+	name := commandName(cli)
+	cmdLogger(name).Info("wait ready: %s", name)
+	start := time.Now()
+	for {
+		var err error
+		if re != nil {
+			err = matchLog(processLogPath(name), offset, re)
+		} else {
+			err = p.check()
+		}
+		if err == nil {
+			cmdLogger(name).Info("ready: %s (%s)", name, time.Since(start).Round(time.Millisecond))
+			return nil
+		}
+
+		if !processAlive(pid) {
+			return fmt.Errorf("%s exited before it was ready", name)
+		}
+		if time.Since(start) >= timeout {
+			return fmt.Errorf("%s not ready after %s, %s", name, timeout, err)
+		}
+		err = sleepContext(ctx, interval)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func matchLog(path string, offset int64, re *regexp.Regexp) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	// rotated since
+	if fi.Size() < offset {
+		offset = 0
+	}
+	f.Seek(offset, 0)
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if !re.Match(b) {
+		return fmt.Errorf("no line matches %q", re)
+	}
+	return nil
+}
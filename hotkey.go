@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.design/x/hotkey"
+)
+
+var (
+	hotKeyKeys = map[string]hotkey.Key{
+		"0": hotkey.Key0, "1": hotkey.Key1, "2": hotkey.Key2, "3": hotkey.Key3, "4": hotkey.Key4,
+		"5": hotkey.Key5, "6": hotkey.Key6, "7": hotkey.Key7, "8": hotkey.Key8, "9": hotkey.Key9,
+		"A": hotkey.KeyA, "B": hotkey.KeyB, "C": hotkey.KeyC, "D": hotkey.KeyD, "E": hotkey.KeyE,
+		"F": hotkey.KeyF, "G": hotkey.KeyG, "H": hotkey.KeyH, "I": hotkey.KeyI, "J": hotkey.KeyJ,
+		"K": hotkey.KeyK, "L": hotkey.KeyL, "M": hotkey.KeyM, "N": hotkey.KeyN, "O": hotkey.KeyO,
+		"P": hotkey.KeyP, "Q": hotkey.KeyQ, "R": hotkey.KeyR, "S": hotkey.KeyS, "T": hotkey.KeyT,
+		"U": hotkey.KeyU, "V": hotkey.KeyV, "W": hotkey.KeyW, "X": hotkey.KeyX, "Y": hotkey.KeyY,
+		"Z": hotkey.KeyZ,
+	}
+
+	toggleMutex sync.Mutex
+	appsToggled bool
+)
+
+func hotKeyActions() map[string]func() {
+	return map[string]func(){
+		"cleanup":        runCleanupHotKey,
+		"show_apps":      runShowAppsHotKey,
+		"hide_apps":      runHideAppsHotKey,
+		"toggle_apps":    runToggleAppsHotKey,
+		"save_layout":    runSaveLayoutHotKey,
+		"restore_layout": runRestoreLayoutHotKey,
+		"desktop_next": func() {
+			runSwitchDesktopHotKey(1)
+		},
+		"desktop_prev": func() {
+			runSwitchDesktopHotKey(-1)
+		},
+	}
+}
+
+// parseHotKey parses strings like "CTRL + SHIFT + ALT + X".
+func parseHotKey(s string) (hotkey.Key, []hotkey.Modifier, error) {
+	var key hotkey.Key
+	var mods []hotkey.Modifier
+	found := false
+	for _, part := range strings.Split(s, "+") {
+		part = strings.ToUpper(strings.TrimSpace(part))
+		if mod, ok := hotKeyModifier(part); ok {
+			mods = append(mods, mod)
+			continue
+		}
+
+		k, ok := hotKeyKeys[part]
+		if !ok || found {
+			return 0, nil, fmt.Errorf("invalid hotkey %q, unknown key %q", s, part)
+		}
+		key, found = k, true
+	}
+
+	if !found || len(mods) == 0 {
+		return 0, nil, fmt.Errorf("invalid hotkey %q, need modifiers and one key", s)
+	}
+	return key, mods, nil
+}
+
+func hotKeyBindings() map[string]string {
+	bindings := map[string]string{"cleanup": "CTRL + SHIFT + ALT + X"}
+	if len(config().ShowApps) > 0 {
+		bindings["show_apps"] = "CTRL + SHIFT + ALT + S"
+	}
+	if len(config().HideApps) > 0 {
+		bindings["hide_apps"] = "CTRL + SHIFT + ALT + H"
+	}
+
+	// an empty string in the config disables a default binding
+	for action, keys := range config().HotKeys {
+		if keys == "" {
+			delete(bindings, action)
+		} else {
+			bindings[action] = keys
+		}
+	}
+	return bindings
+}
+
+func regHotKeys() error {
+	actions := hotKeyActions()
+	bindings := hotKeyBindings()
+
+	names := make([]string, 0, len(bindings))
+	for action := range bindings {
+		if _, ok := actions[action]; !ok {
+			err := fmt.Errorf("unknown hotkey action %s", action)
+			logError("ERR: %s", err)
+			return err
+		}
+		names = append(names, action)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return names[i] == "cleanup" || names[j] != "cleanup" && names[i] < names[j]
+	})
+
+	for _, action := range names {
+		key, mods, err := parseHotKey(bindings[action])
+		if err != nil {
+			logError("ERR: %s", err)
+			return err
+		}
+
+		err = regHotKey(fmt.Sprintf("%s (%s)", bindings[action], action), actions[action], key, mods...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runCleanupHotKey() {
+	sdNotify("STOPPING=1")
+	exitAfterCleanup(exitOK)
+}
+
+func runHideAppsHotKey() {
+	logInfo("[HIDE APPS]")
+	for _, err := range []error{hideApps(config().HideApps), muteApps(config().HideApps)} {
+		if err != nil {
+			logError("---> %s", err)
+		}
+	}
+}
+
+func runShowAppsHotKey() {
+	logInfo("[SHOW APPS]")
+	for _, err := range []error{showApps(config().ShowApps), unmuteApps(config().ShowApps)} {
+		if err != nil {
+			logError("---> %s", err)
+		}
+	}
+}
+
+// runToggleAppsHotKey switches to the work screen on the first press, and
+// back to the personal screen on the next.
+func runToggleAppsHotKey() {
+	toggleMutex.Lock()
+	defer toggleMutex.Unlock()
+
+	var errs []error
+	if !appsToggled {
+		logInfo("[TOGGLE APPS: WORK]")
+		errs = append(errs, hideApps(config().HideApps), muteApps(config().HideApps))
+		errs = append(errs, showApps(config().ShowApps), unmuteApps(config().ShowApps))
+	} else {
+		logInfo("[TOGGLE APPS: PERSONAL]")
+		errs = append(errs, hideApps(config().ShowApps), muteApps(config().ShowApps))
+		errs = append(errs, restoreApps(config().HideApps), unmuteApps(config().HideApps))
+	}
+	appsToggled = !appsToggled
+
+	for _, err := range errs {
+		if err != nil {
+			logError("---> %s", err)
+		}
+	}
+}
+
+func runSwitchDesktopHotKey(delta int) {
+	err := switchDesktop(delta)
+	if err != nil {
+		logError("---> %s", err)
+	}
+}
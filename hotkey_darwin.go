@@ -0,0 +1,17 @@
+package main
+
+import "golang.design/x/hotkey"
+
+func hotKeyModifier(name string) (hotkey.Modifier, bool) {
+	switch name {
+	case "CTRL", "CTL", "CONTROL":
+		return hotkey.ModCtrl, true
+	case "SHIFT":
+		return hotkey.ModShift, true
+	case "ALT", "OPTION":
+		return hotkey.ModOption, true
+	case "CMD", "COMMAND", "SUPER":
+		return hotkey.ModCmd, true
+	}
+	return 0, false
+}
@@ -0,0 +1,17 @@
+package main
+
+import "golang.design/x/hotkey"
+
+func hotKeyModifier(name string) (hotkey.Modifier, bool) {
+	switch name {
+	case "CTRL", "CTL", "CONTROL":
+		return hotkey.ModCtrl, true
+	case "SHIFT":
+		return hotkey.ModShift, true
+	case "ALT":
+		return hotkey.Mod1, true
+	case "SUPER", "WIN":
+		return hotkey.Mod4, true
+	}
+	return 0, false
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var hidIdleRegex = regexp.MustCompile(`"HIDIdleTime" = (\d+)`)
+
+func idleTime() (time.Duration, error) {
+	out, err := exec.Command("ioreg", "-c", "IOHIDSystem", "-d", "4").Output()
+	if err != nil {
+		return 0, err
+	}
+	m := hidIdleRegex.FindSubmatch(out)
+	if m == nil {
+		return 0, errors.New("HIDIdleTime not found")
+	}
+	ns, err := strconv.ParseInt(string(m[1]), 10, 64)
+	return time.Duration(ns), err
+}
@@ -0,0 +1,31 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// idleTime asks Mutter on GNOME, then falls back to xprintidle on X11.
+func idleTime() (time.Duration, error) {
+	conn, err := dbus.SessionBus()
+	if err == nil {
+		var ms uint64
+		obj := conn.Object("org.gnome.Mutter.IdleMonitor", "/org/gnome/Mutter/IdleMonitor/Core")
+		if obj.Call("org.gnome.Mutter.IdleMonitor.GetIdletime", 0).Store(&ms) == nil {
+			return time.Duration(ms) * time.Millisecond, nil
+		}
+	}
+
+	out, err := exec.Command("xprintidle").Output()
+	if err != nil {
+		return 0, err
+	}
+	ms, err := strconv.ParseInt(strings.TrimSpace(string(out)), 10, 64)
+	return time.Duration(ms) * time.Millisecond, err
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"time"
+	"unsafe"
+)
+
+var (
+	procGetLastInputInfo = user32.NewProc("GetLastInputInfo")
+	procGetTickCount     = kernel32.NewProc("GetTickCount")
+)
+
+type lastInputInfo struct {
+	Size uint32
+	Time uint32
+}
+
+func idleTime() (time.Duration, error) {
+	info := lastInputInfo{Size: uint32(unsafe.Sizeof(lastInputInfo{}))}
+	ret, _, err := procGetLastInputInfo.Call(uintptr(unsafe.Pointer(&info)))
+	if ret == 0 {
+		return 0, err
+	}
+	now, _, _ := procGetTickCount.Call()
+	return time.Duration(uint32(now)-info.Time) * time.Millisecond, nil
+}
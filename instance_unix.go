@@ -0,0 +1,29 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+var instanceLock *os.File
+
+// lockInstance holds an flock on a file named after the config dir for
+// the life of the process, so a crash never leaves a stale lock.
+func lockInstance() error {
+	f, err := os.OpenFile(filepath.Join(os.TempDir(), instanceID(configDir)+".lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("safework is already running for %s", configDir)
+	}
+	instanceLock = f
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const errorAlreadyExists = 183
+
+var (
+	procCreateMutexW = syscall.NewLazyDLL("kernel32.dll").NewProc("CreateMutexW")
+
+	instanceMutex uintptr
+)
+
+// lockInstance creates a named mutex for the config dir. Windows releases
+// it when the process exits.
+func lockInstance() error {
+	name, err := syscall.UTF16PtrFromString(`Local\` + instanceID(configDir))
+	if err != nil {
+		return err
+	}
+
+	h, _, err := procCreateMutexW.Call(0, 0, uintptr(unsafe.Pointer(name)))
+	if h == 0 {
+		return err
+	}
+	if errno, ok := err.(syscall.Errno); ok && errno == errorAlreadyExists {
+		syscall.CloseHandle(syscall.Handle(h))
+		return fmt.Errorf("safework is already running for %s", configDir)
+	}
+	instanceMutex = h
+	return nil
+}
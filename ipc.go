@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	ipcRequest struct {
+		Command string   `json:"command"`
+		Args    []string `json:"args,omitempty"`
+	}
+
+	ipcResponse struct {
+		Error  string          `json:"error,omitempty"`
+		Result json.RawMessage `json:"result,omitempty"`
+	}
+)
+
+var ipcHandlers map[string]func(args []string) (interface{}, error)
+
+func init() {
+	ipcHandlers = map[string]func(args []string) (interface{}, error){
+		"ping":    ipcPing,
+		"trigger": ipcTrigger,
+		"stop":    ipcStop,
+		"status":  ipcStatus,
+		"reload":  ipcReload,
+		"run":     ipcRun,
+		"restart": ipcRestart,
+	}
+}
+
+// instanceID identifies the instance running the config in dir.
+func instanceID(dir string) string {
+	sum := sha1.Sum([]byte(strings.ToLower(dir)))
+	return fmt.Sprintf("safework-%x", sum[:6])
+}
+
+// ipcAddress returns the socket of the instance running the config in dir.
+// Windows 10 and later support unix sockets too, so no named pipe is needed.
+func ipcAddress(dir string) string {
+	return filepath.Join(os.TempDir(), instanceID(dir)+".sock")
+}
+
+func startIPCServer() error {
+	// the instance lock is held, so a leftover socket is stale
+	addr := ipcAddress(configDir)
+	os.Remove(addr)
+
+	ln, err := net.Listen("unix", addr)
+	if err != nil {
+		logError("ERR: ipc: %s", err)
+		return err
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveIPC(conn)
+		}
+	}()
+	return nil
+}
+
+func serveIPC(conn net.Conn) {
+	defer conn.Close()
+
+	var req ipcRequest
+	err := json.NewDecoder(conn).Decode(&req)
+	if err != nil {
+		return
+	}
+
+	var resp ipcResponse
+	handler, ok := ipcHandlers[req.Command]
+	if !ok {
+		resp.Error = fmt.Sprintf("unknown command %s", req.Command)
+	} else {
+		result, err := handler(req.Args)
+		if err != nil {
+			resp.Error = err.Error()
+		} else if result != nil {
+			resp.Result, _ = json.Marshal(result)
+		}
+	}
+	json.NewEncoder(conn).Encode(resp)
+}
+
+func ipcPing(args []string) (interface{}, error) {
+	return map[string]interface{}{"pid": os.Getpid(), "config": configDir}, nil
+}
+
+func ipcTrigger(args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errors.New("trigger needs an action")
+	}
+	return nil, triggerActions("ipc", args)
+}
+
+// triggerActions runs hotkey actions in order as if their keys had been
+// pressed. It returns before they run, because actions like cleanup end
+// the process and the caller should get its reply first.
+func triggerActions(source string, names []string) error {
+	all := hotKeyActions()
+	var actions []func()
+	for _, name := range names {
+		action, ok := all[name]
+		if !ok {
+			return fmt.Errorf("unknown action %s", name)
+		}
+		actions = append(actions, action)
+	}
+
+	logInfo("%s trigger: %s", source, strings.Join(names, ", "))
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		for _, action := range actions {
+			action()
+		}
+	}()
+	return nil
+}
+
+func ipcStop(args []string) (interface{}, error) {
+	return ipcTrigger([]string{"cleanup"})
+}
+
+func ipcStatus(args []string) (interface{}, error) {
+	return currentStatus(), nil
+}
+
+func ipcReload(args []string) (interface{}, error) {
+	return nil, reloadConfig()
+}
+
+// ipcRun runs a task and returns its report even when it fails, so the
+// client can show which step broke.
+func ipcRun(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errors.New("run needs one task")
+	}
+	report, err := runTask(args[0])
+	if report == nil {
+		return nil, err
+	}
+	return report.status(), nil
+}
+
+func ipcRestart(args []string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, errors.New("restart needs a pid")
+	}
+	pid, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("bad pid %s", args[0])
+	}
+	return nil, restartManagedProcess(pid)
+}
+
+// ipcCall sends one request to the instance running the config in dir.
+func ipcCall(dir string, command string, args ...string) (json.RawMessage, error) {
+	conn, err := net.DialTimeout("unix", ipcAddress(dir), time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("no running instance for %s", dir)
+	}
+	defer conn.Close()
+
+	err = json.NewEncoder(conn).Encode(ipcRequest{Command: command, Args: args})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ipcResponse
+	err = json.NewDecoder(bufio.NewReader(conn)).Decode(&resp)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return resp.Result, nil
+}
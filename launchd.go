@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+const launchdLabel = "com.safework.agent"
+
+// launchd sends SIGTERM at logout, which runs cleanup; ExitTimeOut gives
+// it time to finish before SIGKILL.
+const launchdPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+%s	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>LimitLoadToSessionType</key>
+	<string>Aqua</string>
+	<key>ProcessType</key>
+	<string>Interactive</string>
+	<key>ExitTimeOut</key>
+	<integer>60</integer>
+	<key>StandardOutPath</key>
+	<string>%s</string>
+	<key>StandardErrorPath</key>
+	<string>%s</string>
+</dict>
+</plist>
+`
+
+// runLaunchd handles `safework launchd install [config dir]`.
+func runLaunchd(args []string) int {
+	if len(args) == 0 || len(args) > 2 || args[0] != "install" {
+		fmt.Println("usage: safework launchd install [config dir]")
+		return 2
+	}
+
+	dir := ""
+	if len(args) > 1 {
+		dir = args[1]
+	}
+
+	path, err := installLaunchAgent(resolveConfigDir(dir))
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+
+	fmt.Printf("launch agent written: %s\n", path)
+	fmt.Printf("load it with: launchctl load -w %s\n", path)
+	return 0
+}
+
+func installLaunchAgent(dir string) (string, error) {
+	err := loadConfig(dir)
+	if err != nil {
+		return "", err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return writeLaunchAgent([]string{exe, dir})
+}
+
+func writeLaunchAgent(argv []string) (string, error) {
+	if runtime.GOOS != "darwin" {
+		return "", errors.New("launch agents are only supported on macOS")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	logs := filepath.Join(home, "Library", "Logs", "safework.log")
+	path := launchAgentPath(home)
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	var args string
+	for _, arg := range argv {
+		args += "\t\t<string>" + xmlEscape(arg) + "</string>\n"
+	}
+	plist := fmt.Sprintf(launchdPlist, launchdLabel, args, xmlEscape(logs), xmlEscape(logs))
+	return path, ioutil.WriteFile(path, []byte(plist), 0644)
+}
+
+func launchAgentPath(home string) string {
+	return filepath.Join(home, "Library", "LaunchAgents", launchdLabel+".plist")
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LayoutWindow is a saved window geometry. handle identifies the live
+// window on the current platform and is never saved.
+type LayoutWindow struct {
+	Process string `json:"process"`
+	Title   string `json:"title,omitempty"`
+	WindowPlacement
+
+	handle string
+}
+
+// layoutApps returns the names of all configured apps.
+func layoutApps() []string {
+	var names []string
+	for _, app := range append(append([]AppSpec{}, config().ShowApps...), config().HideApps...) {
+		if !containsString(names, app.Name) {
+			names = append(names, app.Name)
+		}
+	}
+	return names
+}
+
+func layoutFile(cli CommandLine) string {
+	if len(cli.Args) > 0 {
+		return cli.Args[0]
+	}
+	return filepath.Join(configDir, "layout.json")
+}
+
+func saveLayout(file string) error {
+	apps := layoutApps()
+	if len(apps) == 0 {
+		return errors.New("no show_apps or hide_apps configured")
+	}
+
+	wins, err := captureWindows(apps)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(wins, "", "  ")
+	if err != nil {
+		return err
+	}
+	logInfo("save layout: %d windows to %s", len(wins), file)
+	return ioutil.WriteFile(file, b, 0644)
+}
+
+func loadLayout(file string) ([]LayoutWindow, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var saved []LayoutWindow
+	err = json.Unmarshal(b, &saved)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return saved, nil
+}
+
+// restoreLayout moves every live window that has a saved geometry, matching
+// on process and title first and falling back to the process alone.
+func restoreLayout(saved []LayoutWindow) (int, error) {
+	var apps []string
+	for _, s := range saved {
+		if !containsString(apps, s.Process) {
+			apps = append(apps, s.Process)
+		}
+	}
+
+	wins, err := captureWindows(apps)
+	if err != nil {
+		return 0, err
+	}
+
+	used := make([]bool, len(saved))
+	pick := func(w LayoutWindow, sameTitle bool) *LayoutWindow {
+		for i, s := range saved {
+			if used[i] || !strings.EqualFold(s.Process, w.Process) {
+				continue
+			}
+			if sameTitle && s.Title != w.Title {
+				continue
+			}
+			used[i] = true
+			return &saved[i]
+		}
+		return nil
+	}
+
+	placed := 0
+	var pending []LayoutWindow
+	for _, w := range wins {
+		if s := pick(w, true); s != nil {
+			err = moveWindow(w, s.WindowPlacement)
+			if err != nil {
+				return placed, err
+			}
+			placed++
+		} else {
+			pending = append(pending, w)
+		}
+	}
+	for _, w := range pending {
+		if s := pick(w, false); s != nil {
+			err = moveWindow(w, s.WindowPlacement)
+			if err != nil {
+				return placed, err
+			}
+			placed++
+		}
+	}
+	return placed, nil
+}
+
+func runMacroSaveLayout(ctx context.Context, cli CommandLine) error {
+	return saveLayout(layoutFile(cli))
+}
+
+// runMacroRestoreLayout keeps retrying until every saved window has been
+// placed when a timeout is given, so it can follow apps started earlier.
+func runMacroRestoreLayout(ctx context.Context, cli CommandLine) error {
+	saved, err := loadLayout(layoutFile(cli))
+	if err != nil {
+		return err
+	}
+
+	if macroTimeout(cli) == 0 {
+		placed, err := restoreLayout(saved)
+		logFor(cli).Info("restore layout: %d of %d windows", placed, len(saved))
+		return err
+	}
+
+	return waitFor(ctx, cli, time.Second, func() error {
+		placed, err := restoreLayout(saved)
+		if err != nil {
+			return err
+		}
+		if placed < len(saved) {
+			return fmt.Errorf("%d of %d windows placed", placed, len(saved))
+		}
+		logFor(cli).Info("restore layout: %d windows", placed)
+		return nil
+	})
+}
+
+func runSaveLayoutHotKey() {
+	err := saveLayout(filepath.Join(configDir, "layout.json"))
+	if err != nil {
+		logError("---> %s", err)
+	}
+}
+
+func runRestoreLayoutHotKey() {
+	saved, err := loadLayout(filepath.Join(configDir, "layout.json"))
+	if err == nil {
+		var placed int
+		placed, err = restoreLayout(saved)
+		logInfo("restore layout: %d of %d windows", placed, len(saved))
+	}
+	if err != nil {
+		logError("---> %s", err)
+	}
+}
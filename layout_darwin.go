@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	captureScript = `on run argv
+	set out to ""
+	tell application "System Events"
+		repeat with appName in argv
+			if exists process appName then
+				set i to 0
+				repeat with w in windows of process appName
+					set i to i + 1
+					set p to position of w
+					set s to size of w
+					set out to out & appName & tab & i & tab & (item 1 of p) & tab & (item 2 of p) & tab & (item 1 of s) & tab & (item 2 of s) & tab & (name of w) & linefeed
+				end repeat
+			end if
+		end repeat
+	end tell
+	return out
+end run`
+
+	moveScript = `on run argv
+	tell application "System Events" to tell process (item 1 of argv)
+		set w to window ((item 2 of argv) as integer)
+		set position of w to {(item 3 of argv) as integer, (item 4 of argv) as integer}
+		set size of w to {(item 5 of argv) as integer, (item 6 of argv) as integer}
+	end tell
+end run`
+)
+
+func captureWindows(apps []string) ([]LayoutWindow, error) {
+	out, err := exec.Command("osascript", append([]string{"-e", captureScript}, apps...)...).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var wins []LayoutWindow
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 7)
+		if len(fields) < 7 {
+			continue
+		}
+
+		lw := LayoutWindow{Process: fields[0], Title: fields[6], handle: fields[1]}
+		lw.X, _ = strconv.Atoi(fields[2])
+		lw.Y, _ = strconv.Atoi(fields[3])
+		lw.Width, _ = strconv.Atoi(fields[4])
+		lw.Height, _ = strconv.Atoi(fields[5])
+		wins = append(wins, lw)
+	}
+	return wins, nil
+}
+
+func moveWindow(w LayoutWindow, place WindowPlacement) error {
+	return runQuiet(exec.Command("osascript", "-e", moveScript, w.Process, w.handle,
+		strconv.Itoa(place.X), strconv.Itoa(place.Y), strconv.Itoa(place.Width), strconv.Itoa(place.Height)))
+}
@@ -0,0 +1,59 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+func captureWindows(apps []string) ([]LayoutWindow, error) {
+	if isSway() {
+		return nil, errors.New("window layouts are not supported on sway")
+	}
+	err := checkDisplay()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := exec.Command("wmctrl", "-lpG").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var wins []LayoutWindow
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+		pid, _ := strconv.Atoi(fields[2])
+		name := processName(pid)
+		if !containsString(apps, name) {
+			continue
+		}
+
+		lw := LayoutWindow{
+			Process: name,
+			Title:   strings.Join(fields[8:], " "),
+			handle:  fields[0],
+		}
+		lw.X, _ = strconv.Atoi(fields[3])
+		lw.Y, _ = strconv.Atoi(fields[4])
+		lw.Width, _ = strconv.Atoi(fields[5])
+		lw.Height, _ = strconv.Atoi(fields[6])
+		wins = append(wins, lw)
+	}
+	return wins, nil
+}
+
+func moveWindow(w LayoutWindow, place WindowPlacement) error {
+	geometry := fmt.Sprintf("0,%d,%d,%d,%d", place.X, place.Y, place.Width, place.Height)
+	return runQuiet(exec.Command("wmctrl", "-i", "-r", w.handle, "-e", geometry))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"unsafe"
+)
+
+var procIsZoomed = user32.NewProc("IsZoomed")
+
+func captureWindows(apps []string) ([]LayoutWindow, error) {
+	monitors := monitorRects()
+
+	var wins []LayoutWindow
+	for _, w := range listWindows(false) {
+		app := ""
+		for _, name := range apps {
+			if (WindowMatch{Process: name}).matchProcess(w.process) {
+				app = name
+				break
+			}
+		}
+		if app == "" {
+			continue
+		}
+
+		var r rect
+		procGetWindowRect.Call(w.hwnd, uintptr(unsafe.Pointer(&r)))
+		zoomed, _, _ := procIsZoomed.Call(w.hwnd)
+
+		lw := LayoutWindow{
+			Process: app,
+			Title:   w.title,
+			WindowPlacement: WindowPlacement{
+				X:        int(r.Left),
+				Y:        int(r.Top),
+				Width:    int(r.Right - r.Left),
+				Height:   int(r.Bottom - r.Top),
+				Maximize: zoomed != 0,
+			},
+			handle: strconv.FormatUint(uint64(w.hwnd), 10),
+		}
+
+		cx, cy := (r.Left+r.Right)/2, (r.Top+r.Bottom)/2
+		for i, m := range monitors {
+			if cx >= m.Left && cx < m.Right && cy >= m.Top && cy < m.Bottom {
+				lw.Monitor = i + 1
+				lw.X -= int(m.Left)
+				lw.Y -= int(m.Top)
+				break
+			}
+		}
+		wins = append(wins, lw)
+	}
+	return wins, nil
+}
+
+// moveWindow falls back to the primary monitor when the saved one is gone,
+// e.g. after undocking.
+func moveWindow(w LayoutWindow, place WindowPlacement) error {
+	hwnd, err := strconv.ParseUint(w.handle, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad window handle %q", w.handle)
+	}
+
+	if place.Monitor > len(monitorRects()) {
+		place.Monitor = 1
+	}
+	return placeWindow(uintptr(hwnd), &place)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+func listeningPids(port int) ([]int, error) {
+	out, err := exec.Command("lsof", "-nP", "-t", "-iTCP:"+strconv.Itoa(port), "-sTCP:LISTEN").Output()
+	if err != nil {
+		// lsof exits 1 when nothing matches
+		if _, ok := err.(*exec.ExitError); ok && len(out) == 0 {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var pids []int
+	for _, line := range strings.Fields(string(out)) {
+		pid, err := strconv.Atoi(line)
+		if err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
@@ -0,0 +1,63 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// listeningPids finds the sockets listening on port in /proc/net, then the
+// processes holding them open.
+func listeningPids(port int) ([]int, error) {
+	inodes := make(map[string]bool)
+	for _, name := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		f, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			// sl local_address rem_address st tx:rx tr:when retrnsmt uid timeout inode
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 10 || fields[3] != "0A" {
+				continue
+			}
+			i := strings.LastIndexByte(fields[1], ':')
+			p, err := strconv.ParseInt(fields[1][i+1:], 16, 32)
+			if err == nil && int(p) == port {
+				inodes["socket:["+fields[9]+"]"] = true
+			}
+		}
+		f.Close()
+	}
+	if len(inodes) == 0 {
+		return nil, nil
+	}
+
+	dirs, err := filepath.Glob("/proc/[0-9]*/fd")
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, dir := range dirs {
+		fds, _ := filepath.Glob(dir + "/*")
+		for _, fd := range fds {
+			link, err := os.Readlink(fd)
+			if err != nil || !inodes[link] {
+				continue
+			}
+			pid, _ := strconv.Atoi(filepath.Base(filepath.Dir(dir)))
+			pids = append(pids, pid)
+			break
+		}
+	}
+	if len(pids) == 0 {
+		return nil, fmt.Errorf("port %d is in use by a process that can't be inspected", port)
+	}
+	return pids, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+func listeningPids(port int) ([]int, error) {
+	out, err := exec.Command("netstat", "-ano").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool)
+	var pids []int
+	suffix := ":" + strconv.Itoa(port)
+	for _, line := range strings.Split(string(out), "\n") {
+		// TCP    0.0.0.0:8080    0.0.0.0:0    LISTENING    1234
+		// the state is translated, but a listener has no remote port
+		fields := strings.Fields(line)
+		if len(fields) != 5 || fields[0] != "TCP" || !strings.HasSuffix(fields[1], suffix) || !strings.HasSuffix(fields[2], ":0") {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[4])
+		if err == nil && pid != 0 && !seen[pid] {
+			seen[pid] = true
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
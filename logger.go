@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	levelTrace = iota
+	levelDebug
+	levelInfo
+	levelWarn
+	levelError
+)
+
+// LogConfig sets the console log level, trace, debug, info, warn or error, and
+// the format, text or json. File keeps a copy of the console, rotated at
+// MaxSize MB (default 10) with Keep old files (default 3). The -log-level,
+// -log-format and -log-file flags win. System also sends warnings and
+// errors to syslog, or the Windows Event Log, whatever the console level.
+type LogConfig struct {
+	Level   string `json:"level,omitempty"`
+	Format  string `json:"format,omitempty"`
+	File    string `json:"file,omitempty"`
+	MaxSize int    `json:"max_size,omitempty"`
+	Keep    int    `json:"keep,omitempty"`
+	System  bool   `json:"system,omitempty"`
+}
+
+var (
+	levelNames = []string{"trace", "debug", "info", "warn", "error"}
+
+	logLevel   = levelInfo
+	logJSON    bool
+	logMutex   sync.Mutex
+	flagLevel  string
+	flagFormat string
+	systemLog  func(level int, msg string)
+
+	// -v, -vv and -q
+	flagVerbose     bool
+	flagVeryVerbose bool
+	flagQuiet       bool
+
+	// colors only go to a terminal, see https://no-color.org
+	flagNoColor bool
+	colorOutput bool
+	ansiRegex   = regexp.MustCompile("\x1b\\[[0-9;]*m")
+)
+
+const (
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorReset  = "\x1b[0m"
+)
+
+func parseLevel(s string) (int, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, use trace, debug, info, warn or error", s)
+}
+
+// setupLogging applies the log config, then the flags over it.
+func setupLogging(cfg *LogConfig) error {
+	level, format := flagLevel, flagFormat
+	if cfg != nil {
+		if level == "" {
+			level = cfg.Level
+		}
+		if format == "" {
+			format = cfg.Format
+		}
+	}
+
+	if level != "" {
+		l, err := parseLevel(level)
+		if err != nil {
+			return err
+		}
+		logLevel = l
+	}
+	switch {
+	case flagQuiet:
+		logLevel = levelWarn
+	case flagVeryVerbose:
+		logLevel = levelTrace
+	case flagVerbose:
+		logLevel = levelDebug
+	}
+
+	switch format {
+	case "", "text":
+		logJSON = false
+	case "json":
+		logJSON = true
+	default:
+		return fmt.Errorf("unknown log format %q, use text or json", format)
+	}
+
+	colorOutput = !logJSON && !flagNoColor && os.Getenv("NO_COLOR") == "" && enableColor(os.Stdout)
+
+	if cfg != nil && cfg.System && systemLog == nil {
+		// not fatal, the console still works
+		l, err := openSystemLog()
+		if err != nil {
+			logError("ERR: system log, %s", err)
+		}
+		systemLog = l
+	}
+	return nil
+}
+
+// colorStatus colors ok, skipped and failed for the terminal.
+func colorStatus(status string) string {
+	if !colorOutput {
+		return status
+	}
+	switch status {
+	case "ok":
+		return colorGreen + status + colorReset
+	case "skipped":
+		return colorYellow + status + colorReset
+	case "failed":
+		return colorRed + status + colorReset
+	}
+	return status
+}
+
+// logf writes one log entry. Text lines start with the time and the
+// source, if any, and an empty message is a blank line, which json mode
+// leaves out.
+func logf(level int, format string, args ...interface{}) {
+	logEntry(level, "", format, args...)
+}
+
+func logEntry(level int, source, format string, args ...interface{}) {
+	if level < logLevel {
+		if level >= levelWarn && systemLog != nil {
+			writeSystemLog(level, source, formatMsg(format, args))
+		}
+		return
+	}
+	writeEntry(level, source, format, args...)
+}
+
+func formatMsg(format string, args []interface{}) string {
+	if len(args) > 0 {
+		return fmt.Sprintf(format, args...)
+	}
+	return format
+}
+
+func writeEntry(level int, source, format string, args ...interface{}) {
+	msg := formatMsg(format, args)
+	now := time.Now()
+	if level >= levelWarn && systemLog != nil {
+		writeSystemLog(level, source, msg)
+	}
+
+	logMutex.Lock()
+	defer logMutex.Unlock()
+
+	if !logJSON {
+		if msg == "" {
+			fmt.Fprintln(os.Stdout)
+			return
+		}
+
+		prefix := "[" + now.Format("15:04:05")
+		if source != "" {
+			prefix += " " + source
+		}
+		prefix += "] "
+		var b strings.Builder
+		for _, line := range strings.Split(msg, "\n") {
+			b.WriteString(prefix + line + "\n")
+		}
+		os.Stdout.WriteString(b.String())
+		return
+	}
+	if msg == "" {
+		return
+	}
+
+	for _, prefix := range []string{"ERR: ", "---> "} {
+		msg = strings.TrimPrefix(msg, prefix)
+	}
+	b, _ := json.Marshal(struct {
+		Time   string `json:"time"`
+		Level  string `json:"level"`
+		Source string `json:"source,omitempty"`
+		Msg    string `json:"msg"`
+	}{now.Format("2006-01-02T15:04:05.000Z07:00"), levelNames[level], source, msg})
+	os.Stdout.Write(append(b, '\n'))
+}
+
+func writeSystemLog(level int, source, msg string) {
+	if msg == "" {
+		return
+	}
+	for _, prefix := range []string{"ERR: ", "---> "} {
+		msg = strings.TrimPrefix(msg, prefix)
+	}
+	if source != "" {
+		msg = source + ": " + msg
+	}
+	systemLog(level, msg)
+}
+
+func logTrace(format string, args ...interface{}) { logf(levelTrace, format, args...) }
+func logDebug(format string, args ...interface{}) { logf(levelDebug, format, args...) }
+func logInfo(format string, args ...interface{})  { logf(levelInfo, format, args...) }
+func logWarn(format string, args ...interface{})  { logf(levelWarn, format, args...) }
+func logError(format string, args ...interface{}) { logf(levelError, format, args...) }
+
+// logSection starts a block of output with a blank line and a title.
+func logSection(format string, args ...interface{}) {
+	logInfo("")
+	logInfo(format, args...)
+}
+
+// logSummary shows the summary of a run. It is kept with -q, where only
+// failures show otherwise.
+func logSummary(failed bool, title, table string) {
+	level := levelInfo
+	if failed {
+		level = levelError
+	}
+	if logLevel > levelWarn && !failed {
+		return
+	}
+
+	if logLevel <= levelInfo {
+		writeEntry(level, "", "")
+	}
+	writeEntry(level, "", "[%s SUMMARY]", title)
+	writeEntry(level, "", "%s", table)
+}
+
+// cmdLogger tags entries with the command or macro they come from, so
+// the output of parallel steps can be told apart.
+type cmdLogger string
+
+func logFor(cli CommandLine) cmdLogger {
+	return cmdLogger(commandName(cli))
+}
+
+func (l cmdLogger) Trace(format string, args ...interface{}) {
+	logEntry(levelTrace, string(l), format, args...)
+}
+
+func (l cmdLogger) Debug(format string, args ...interface{}) {
+	logEntry(levelDebug, string(l), format, args...)
+}
+
+func (l cmdLogger) Info(format string, args ...interface{}) {
+	logEntry(levelInfo, string(l), format, args...)
+}
+
+func (l cmdLogger) Warn(format string, args ...interface{}) {
+	logEntry(levelWarn, string(l), format, args...)
+}
+
+func (l cmdLogger) Error(format string, args ...interface{}) {
+	logEntry(levelError, string(l), format, args...)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	teeDone     chan struct{}
+	logFile     *os.File
+	logFileSize int64
+	flagLogFile string
+)
+
+func logFilePath() string {
+	return filepath.Join(configDir, "safework.log")
+}
+
+// configuredLogFile is the -log-file flag, else the file in the log config,
+// relative to the config dir, else the default in tray mode.
+func configuredLogFile() string {
+	path := flagLogFile
+	if path == "" && config().Log != nil {
+		path = os.ExpandEnv(config().Log.File)
+	}
+	if path == "" && trayMode {
+		return logFilePath()
+	}
+	if path != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(configDir, path)
+	}
+	return path
+}
+
+// openLogFile copies console output to path, for runs without a console
+// and for a record of what happened earlier in the day.
+func openLogFile(path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	logFile, logFileSize = f, fi.Size()
+	return startLogTee()
+}
+
+// writeLogFile rotates the log file once it grows over the limit.
+func writeLogFile(b []byte) {
+	size, keep := int64(10), 3
+	if cfg := config().Log; cfg != nil {
+		if cfg.MaxSize > 0 {
+			size = int64(cfg.MaxSize)
+		}
+		if cfg.Keep > 0 {
+			keep = cfg.Keep
+		}
+	}
+
+	if logFileSize > 0 && logFileSize+int64(len(b)) > size<<20 {
+		path := logFile.Name()
+		logFile.Close()
+		shiftLogs(path, keep)
+		os.Rename(path, path+".1")
+
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			logFile = nil
+			return
+		}
+		logFile, logFileSize = f, 0
+	}
+
+	n, _ := logFile.Write(b)
+	logFileSize += int64(n)
+}
+
+// startLogTee routes os.Stdout through a pipe, so console lines can be
+// streamed to clients while they still reach the console.
+func startLogTee() error {
+	if teeDone != nil {
+		return nil
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	console := os.Stdout
+	os.Stdout = w
+	teeDone = make(chan struct{})
+
+	go func() {
+		defer close(teeDone)
+
+		var pending string
+		buf := make([]byte, 4096)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				console.Write(buf[:n])
+				plain := buf[:n]
+				if colorOutput {
+					plain = ansiRegex.ReplaceAll(plain, nil)
+				}
+				if logFile != nil {
+					writeLogFile(plain)
+				}
+				pending += string(plain)
+				for {
+					i := strings.IndexByte(pending, '\n')
+					if i < 0 {
+						break
+					}
+					publishEvent(Event{Type: "log", Text: strings.TrimRight(pending[:i], "\r")})
+					pending = pending[i+1:]
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// exit flushes the console tee before ending the process.
+func exit(code int) {
+	if teeDone != nil {
+		os.Stdout.Close()
+		select {
+		case <-teeDone:
+		case <-time.After(time.Second):
+		}
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,996 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type macroSpec struct {
+	run    func(ctx context.Context, cli CommandLine) error
+	params []string
+	// minArgs counts args, positional or given by an argOptions key
+	minArgs int
+}
+
+var (
+	builtinMacros map[string]macroSpec
+
+	errNotReady    = errors.New("not ready")
+	errCanceled    = errors.New("canceled")
+	errDeadline    = errors.New("deadline exceeded")
+	optionKeyRegex = regexp.MustCompile(`^[a-z][a-z_]*$`)
+
+	// options that may stand in for a positional arg, like url=...
+	argOptions = []string{"url", "match", "file", "title", "message", "process", "share", "target", "duration"}
+)
+
+func init() {
+	builtinMacros = map[string]macroSpec{
+		"!WAIT_FILE":         {runMacroWaitFile, waitParams(), 1},
+		"!WAIT_PORT":         {runMacroWaitPort, waitParams(), 1},
+		"!WAIT_PORT_FREE":    {runMacroWaitPortFree, waitParams(), 1},
+		"!WAIT_PROCESS_EXIT": {runMacroWaitProcessExit, waitParams(), 1},
+		"!WAIT_HTTP":         {runMacroWaitHTTP, waitParams("url", "status"), 1},
+		"!WAIT_URL_CONTENT":  {runMacroWaitURLContent, waitParams("url", "match"), 2},
+		"!WAIT_NETWORK":      {runMacroWaitNetwork, waitParams(), 1},
+		"!WAIT_FILE_CHANGED": {runMacroWaitFileChanged, waitParams("file", "match"), 1},
+		"!WAIT_DB":           {runMacroWaitDB, waitParams(), 1},
+		"!WAIT_PID_FILE":     {runMacroWaitPidFile, waitParams("file", "record"), 1},
+		"!KILL_PROCESS":      {runMacroKillProcess, []string{"mode", "timeout"}, 1},
+		"!KILL_PORT":         {runMacroKillPort, []string{"mode", "timeout"}, 1},
+		"!ADOPT":             {runMacroAdopt, waitParams("name"), 1},
+		"!NOTIFY":            {runMacroNotify, []string{"title", "message"}, 1},
+		"!PROMPT":            {runMacroPrompt, nil, 1},
+		"!COPY":              {runMacroCopy, nil, 2},
+		"!MOVE":              {runMacroMove, nil, 2},
+		"!DELETE":            {runMacroDelete, nil, 1},
+		"!MKDIR":             {runMacroMkdir, nil, 1},
+		"!CLEAN_DIR":         {runMacroCleanDir, nil, 1},
+		"!OPEN_URL":          {runMacroOpenURL, []string{"browser"}, 1},
+		"!CLIPBOARD":         {runMacroClipboard, nil, 1},
+		"!MOUNT":             {runMacroMount, []string{"share", "target"}, 2},
+		"!UNMOUNT":           {runMacroUnmount, nil, 1},
+		"!GIT_SYNC":          {runMacroGitSync, nil, 1},
+		"!SOUND":             {runMacroSound, nil, 0},
+		"!SLEEP":             {runMacroSleep, []string{"duration"}, 1},
+		"!SAVE_LAYOUT":       {runMacroSaveLayout, nil, 0},
+		"!RESTORE_LAYOUT":    {runMacroRestoreLayout, waitParams(), 0},
+		"!FOCUS_WINDOW":      {runMacroFocusWindow, []string{"title", "process", "monitor", "x", "y", "width", "height", "maximize"}, 1},
+	}
+}
+
+func waitParams(params ...string) []string {
+	return append(params, "timeout", "interval")
+}
+
+func runMacro(ctx context.Context, cli CommandLine) error {
+	logFor(cli).Info("run macro: %s %s", cli.Command, strings.Join(cli.Args, " "))
+	name := strings.ToUpper(cli.Command)
+	if spec, ok := builtinMacros[name]; ok {
+		cli, err := parseMacroArgs(cli, spec.params)
+		if err != nil {
+			return err
+		}
+		if macroArgCount(cli) < spec.minArgs {
+			return fmt.Errorf("%s: missing arguments, needs %d", cli.Command, spec.minArgs)
+		}
+		for _, key := range spec.params {
+			if v, ok := cli.options[key]; ok {
+				logFor(cli).Debug("option: %s=%s", key, v)
+			}
+		}
+		return spec.run(ctx, cli)
+	}
+
+	steps, ok := config().Macros[name]
+	if !ok {
+		return fmt.Errorf("unknown macro %s", cli.Command)
+	}
+	return runCommands(ctx, userMacroSteps(cli, steps), false, nil)
+}
+
+// parseMacroArgs moves key=value args into cli.options, and reports keys
+// that are not among the macro's params, like a typo. Conditions such as
+// status==ready, status!=down or body~=ok stay positional, and so does
+// everything for macros that declare no params.
+func parseMacroArgs(cli CommandLine, params []string) (CommandLine, error) {
+	if len(params) == 0 {
+		return cli, nil
+	}
+
+	var args []string
+	options := make(map[string]string)
+	for _, arg := range cli.Args {
+		key, value, ok := cutOption(arg)
+		if !ok {
+			args = append(args, arg)
+			continue
+		}
+
+		if !containsString(params, key) {
+			return cli, fmt.Errorf("%s: unknown option %s, supported options: %s", cli.Command, key, strings.Join(params, ", "))
+		}
+
+		if _, dup := options[key]; dup {
+			return cli, fmt.Errorf("%s: option %q given more than once", cli.Command, key)
+		}
+
+		err := checkOptionValue(key, value)
+		if err != nil {
+			return cli, fmt.Errorf("%s: invalid %s=%q, %s", cli.Command, key, value, err)
+		}
+		options[key] = value
+	}
+
+	cli.Args = args
+	cli.options = options
+	return cli, nil
+}
+
+// cutOption splits key=value, but not the conditions key==value,
+// key!=value and key~=value.
+func cutOption(arg string) (string, string, bool) {
+	key, value, ok := strings.Cut(arg, "=")
+	if !ok || strings.HasPrefix(value, "=") || !optionKeyRegex.MatchString(key) {
+		return "", "", false
+	}
+	return key, value, true
+}
+
+func checkOptionValue(key, value string) error {
+	switch key {
+	case "timeout", "interval", "duration":
+		d, err := parseDuration(value)
+		if err != nil {
+			return errors.New("expect a duration like 5s or 250ms")
+		}
+		if d < 0 || (key == "interval" && d == 0) {
+			return errors.New("duration must be positive")
+		}
+	case "status":
+		_, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("expect an HTTP status code")
+		}
+	case "monitor", "x", "y", "width", "height":
+		_, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("expect an integer")
+		}
+	case "record", "maximize":
+		_, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("expect true or false")
+		}
+	case "mode":
+		if value != "graceful" && value != "force" {
+			return errors.New("expect graceful or force")
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// macroArg returns the named option key, or the positional arg at index i.
+// macroArgCount counts the positional args and the options standing in
+// for them.
+func macroArgCount(cli CommandLine) int {
+	n := len(cli.Args)
+	for _, key := range argOptions {
+		if _, ok := cli.options[key]; ok {
+			n++
+		}
+	}
+	return n
+}
+
+func macroArg(cli CommandLine, key string, i int) string {
+	if v, ok := cli.options[key]; ok {
+		return v
+	}
+	if i >= 0 && i < len(cli.Args) {
+		return cli.Args[i]
+	}
+	return ""
+}
+
+func optionDuration(cli CommandLine, key string, def time.Duration) time.Duration {
+	v, ok := cli.options[key]
+	if !ok {
+		return def
+	}
+	d, _ := parseDuration(v)
+	return d
+}
+
+func macroTimeout(cli CommandLine) time.Duration {
+	return optionDuration(cli, "timeout", cli.Timeout*time.Second)
+}
+
+// waitFor polls check until it returns nil or the macro timeout expires,
+// a minute when there is none.
+func waitFor(ctx context.Context, cli CommandLine, interval time.Duration, check func() error) error {
+	interval = optionDuration(cli, "interval", interval)
+	timeout := macroTimeout(cli)
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+	expire := time.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		err := check()
+		if err == nil {
+			logFor(cli).Trace("attempt %d: ok", attempt)
+			countRetries(commandName(cli), attempt-1)
+			return nil
+		}
+		logFor(cli).Trace("attempt %d: %s", attempt, err)
+
+		if !time.Now().Before(expire) {
+			countRetries(commandName(cli), attempt-1)
+			if err == errNotReady {
+				return errors.New("timeout")
+			}
+			return fmt.Errorf("timeout, %s", err)
+		}
+
+		err = sleepContext(ctx, interval)
+		if err != nil {
+			countRetries(commandName(cli), attempt-1)
+			return err
+		}
+	}
+}
+
+// sleepContext sleeps for d, or returns the reason as soon as ctx is
+// done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return contextError(ctx)
+	}
+}
+
+func contextError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return errDeadline
+	}
+	return errCanceled
+}
+
+// userMacroSteps substitutes {0}, {1}..., {args} and {key} for key=value
+// args in the steps of a macro defined in the config.
+func userMacroSteps(cli CommandLine, steps []CommandLine) []CommandLine {
+	var args []string
+	params := make(map[string]string)
+	for _, arg := range cli.Args {
+		key, value, ok := cutOption(arg)
+		if ok {
+			params[key] = value
+		} else {
+			args = append(args, arg)
+		}
+	}
+	params["args"] = strings.Join(args, " ")
+	for i, arg := range args {
+		params[strconv.Itoa(i)] = arg
+	}
+
+	expanded := make([]CommandLine, len(steps))
+	for i, step := range steps {
+		expanded[i] = substituteParams(step, params)
+	}
+	return expanded
+}
+
+func runMacroWaitFile(ctx context.Context, cli CommandLine) error {
+	return waitFor(ctx, cli, time.Second/2, func() error {
+		for _, name := range cli.Args {
+			_, err := os.Stat(name)
+			if err != nil {
+				return errNotReady
+			}
+		}
+		return nil
+	})
+}
+
+func runMacroWaitPort(ctx context.Context, cli CommandLine) error {
+	return waitFor(ctx, cli, time.Second/10, func() error {
+		for _, port := range cli.Args {
+			conn, err := net.DialTimeout("tcp", port, time.Second/2)
+			if err != nil {
+				return errNotReady
+			}
+			conn.Close()
+		}
+		return nil
+	})
+}
+
+func runMacroSleep(ctx context.Context, cli CommandLine) error {
+	arg := macroArg(cli, "duration", 0)
+	if arg == "" {
+		return errors.New("!SLEEP requires a duration argument")
+	}
+
+	d, err := parseDuration(arg)
+	if err != nil {
+		return err
+	}
+
+	return sleepContext(ctx, d)
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func runMacroWaitProcessExit(ctx context.Context, cli CommandLine) error {
+	return waitFor(ctx, cli, time.Second/2, func() error {
+		for _, target := range cli.Args {
+			alive, err := targetProcessAlive(target)
+			if err != nil {
+				return err
+			}
+			if alive {
+				return errNotReady
+			}
+		}
+		return nil
+	})
+}
+
+// targetProcessAlive accepts a PID, a pidfile path or a process name.
+func targetProcessAlive(target string) (bool, error) {
+	pids, err := targetPids(target)
+	if err != nil {
+		return false, err
+	}
+
+	for _, pid := range pids {
+		if processAlive(pid) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// targetPids resolves a PID, pidfile, :port listener or process name.
+func targetPids(target string) ([]int, error) {
+	if pid, err := strconv.Atoi(target); err == nil {
+		// kill(2) takes 0 and -1 as the process group and every process
+		if pid <= 0 {
+			return nil, fmt.Errorf("invalid pid %d", pid)
+		}
+		return []int{pid}, nil
+	}
+
+	if strings.HasPrefix(target, ":") {
+		port, err := strconv.Atoi(target[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %s", target)
+		}
+		return listeningPids(port)
+	}
+
+	if _, err := os.Stat(target); err == nil {
+		pid, err := readPidFile(target)
+		if err != nil {
+			return nil, err
+		}
+		return []int{pid}, nil
+	}
+
+	return findProcesses(target)
+}
+
+func runMacroKillProcess(ctx context.Context, cli CommandLine) error {
+	args := cli.Args
+	force := cli.options["mode"] == "force"
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "force":
+			force = true
+			args = args[1:]
+		case "graceful":
+			args = args[1:]
+		}
+	}
+	if len(args) == 0 {
+		return errors.New("!KILL_PROCESS requires a process name, PID, pidfile or :port")
+	}
+	return killTargets(ctx, cli, args, force)
+}
+
+// runMacroKillPort stops whatever listens on the given ports, like a
+// server left over from a crashed session.
+func runMacroKillPort(ctx context.Context, cli CommandLine) error {
+	args := cli.Args
+	force := cli.options["mode"] == "force"
+	if len(args) > 0 && strings.ToLower(args[0]) == "force" {
+		force = true
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return errors.New("!KILL_PORT requires at least one port")
+	}
+
+	targets := make([]string, len(args))
+	for i, port := range args {
+		targets[i] = ":" + strings.TrimPrefix(port, ":")
+	}
+	return killTargets(ctx, cli, targets, force)
+}
+
+func killTargets(ctx context.Context, cli CommandLine, targets []string, force bool) error {
+	var pids []int
+	for _, target := range targets {
+		found, err := targetPids(target)
+		if err != nil {
+			return err
+		}
+		for _, pid := range found {
+			if processAlive(pid) {
+				pids = append(pids, pid)
+			}
+		}
+	}
+
+	if len(pids) == 0 {
+		logFor(cli).Info("no process found: %s", strings.Join(targets, " "))
+	}
+	for _, pid := range pids {
+		logFor(cli).Info("kill process %d", pid)
+		err := killProcess(pid, force)
+		if err != nil {
+			return err
+		}
+	}
+
+	timeout := macroTimeout(cli)
+	if force || timeout <= 0 {
+		return nil
+	}
+
+	expire := time.Now().Add(timeout)
+	for time.Now().Before(expire) {
+		alive := false
+		for _, pid := range pids {
+			if processAlive(pid) {
+				alive = true
+				break
+			}
+		}
+		if !alive {
+			return nil
+		}
+		err := sleepContext(ctx, time.Second/2)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, pid := range pids {
+		if processAlive(pid) {
+			logFor(cli).Warn("force kill process %d", pid)
+			err := killProcess(pid, true)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runMacroAdopt records processes started by other tools, so cleanup
+// stops them with the ones safework started.
+func runMacroAdopt(ctx context.Context, cli CommandLine) error {
+	if len(cli.Args) == 0 {
+		return errors.New("!ADOPT requires a process name, PID, pidfile or :port")
+	}
+
+	type adoptee struct {
+		name string
+		pid  int
+	}
+	var found []adoptee
+	err := waitFor(ctx, cli, time.Second/2, func() error {
+		found = nil
+		for _, target := range cli.Args {
+			pids, err := targetPids(target)
+			if err != nil {
+				return err
+			}
+
+			n := len(found)
+			for _, pid := range pids {
+				if pid != os.Getpid() && processAlive(pid) {
+					found = append(found, adoptee{target, pid})
+				}
+			}
+			if len(found) == n {
+				return fmt.Errorf("no process matches %s", target)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, a := range found {
+		name := cli.options["name"]
+		if name == "" {
+			name = a.name
+		}
+		logFor(cli).Info("adopt: %s (pid %d)", name, a.pid)
+		addManagedProcess(name, a.pid)
+	}
+	return nil
+}
+
+func readPidFile(name string) (int, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid pidfile %s", name)
+	}
+	return pid, nil
+}
+
+func runMacroWaitPortFree(ctx context.Context, cli CommandLine) error {
+	return waitFor(ctx, cli, time.Second/10, func() error {
+		for _, port := range cli.Args {
+			conn, err := net.DialTimeout("tcp", port, time.Second/2)
+			if err == nil {
+				conn.Close()
+				return errNotReady
+			}
+		}
+		return nil
+	})
+}
+
+func runMacroNotify(ctx context.Context, cli CommandLine) error {
+	title, message := cli.options["title"], cli.options["message"]
+	if title != "" || message != "" {
+		if message == "" {
+			message = strings.Join(cli.Args, " ")
+		}
+		if title == "" {
+			title = "safework"
+		}
+		return notify(title, message)
+	}
+
+	switch len(cli.Args) {
+	case 1:
+		return notify("safework", cli.Args[0])
+	case 2:
+		return notify(cli.Args[0], cli.Args[1])
+	default:
+		return errors.New("!NOTIFY requires [title] message")
+	}
+}
+
+func runMacroPrompt(ctx context.Context, cli CommandLine) error {
+	if len(cli.Args) != 1 {
+		return errors.New("!PROMPT requires a question")
+	}
+
+	if !askConfirm(cli.Args[0]) {
+		return errors.New("declined by user")
+	}
+	return nil
+}
+
+func runMacroWaitHTTP(ctx context.Context, cli CommandLine) error {
+	url := macroArg(cli, "url", 0)
+	if url == "" {
+		return errors.New("!WAIT_HTTP requires url")
+	}
+	i := 1
+	if _, ok := cli.options["url"]; ok {
+		i = 0
+	}
+	status, _ := strconv.Atoi(macroArg(cli, "status", i))
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	return waitFor(ctx, cli, time.Second/2, func() error {
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if status == 0 && resp.StatusCode >= 200 && resp.StatusCode < 300 || resp.StatusCode == status {
+			return nil
+		}
+		return fmt.Errorf("status %d", resp.StatusCode)
+	})
+}
+
+func runMacroWaitURLContent(ctx context.Context, cli CommandLine) error {
+	url, cond := macroArg(cli, "url", 0), macroArg(cli, "match", 1)
+	if _, ok := cli.options["url"]; ok {
+		cond = macroArg(cli, "match", 0)
+	}
+	if url == "" || cond == "" {
+		return errors.New("!WAIT_URL_CONTENT requires url and condition")
+	}
+
+	match, err := parseContentCondition(cond)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	return waitFor(ctx, cli, time.Second/2, func() error {
+		resp, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if !match(body) {
+			return errNotReady
+		}
+		return nil
+	})
+}
+
+// parseContentCondition accepts either `path == value` / `path != value`
+// evaluated against a JSON body, or a regular expression.
+func parseContentCondition(cond string) (func([]byte) bool, error) {
+	for _, op := range []string{"==", "!="} {
+		i := strings.Index(cond, op)
+		if i < 0 {
+			continue
+		}
+
+		path := strings.TrimSpace(cond[:i])
+		want := parseJSONValue(strings.TrimSpace(cond[i+len(op):]))
+		equal := op == "=="
+		return func(body []byte) bool {
+			var doc interface{}
+			if json.Unmarshal(body, &doc) != nil {
+				return false
+			}
+			got, ok := lookupJSON(doc, path)
+			if !ok {
+				return false
+			}
+			return reflect.DeepEqual(got, want) == equal
+		}, nil
+	}
+
+	re, err := regexp.Compile(cond)
+	if err != nil {
+		return nil, err
+	}
+	return re.Match, nil
+}
+
+func parseJSONValue(s string) interface{} {
+	var v interface{}
+	if json.Unmarshal([]byte(s), &v) != nil {
+		return s
+	}
+	return v
+}
+
+// lookupJSON resolves a dotted path such as `data.items.0.status`.
+func lookupJSON(doc interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return doc, true
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			next, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			doc = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			doc = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+func runMacroOpenURL(ctx context.Context, cli CommandLine) error {
+	browser := cli.options["browser"]
+	var urls []string
+	for _, arg := range cli.Args {
+		if strings.Contains(arg, "://") {
+			urls = append(urls, arg)
+		} else if browser == "" {
+			browser = arg
+		} else {
+			return fmt.Errorf("invalid url %s", arg)
+		}
+	}
+	if len(urls) == 0 {
+		return errors.New("!OPEN_URL requires at least one url")
+	}
+
+	for _, url := range urls {
+		err := openURL(browser, url)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runMacroClipboard(ctx context.Context, cli CommandLine) error {
+	if len(cli.Args) == 0 {
+		return errors.New("!CLIPBOARD requires set, clear, file or command")
+	}
+
+	var text string
+	args := cli.Args[1:]
+	switch strings.ToLower(cli.Args[0]) {
+	case "set":
+		text = strings.Join(args, " ")
+	case "clear":
+	case "file":
+		if len(args) != 1 {
+			return errors.New("!CLIPBOARD file requires a path")
+		}
+		b, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		text = string(b)
+	case "command":
+		if len(args) == 0 {
+			return errors.New("!CLIPBOARD command requires a command")
+		}
+		out, err := exec.Command(args[0], args[1:]...).Output()
+		if err != nil {
+			return err
+		}
+		text = strings.TrimRight(string(out), "\r\n")
+	default:
+		return fmt.Errorf("unknown clipboard action %s", cli.Args[0])
+	}
+
+	return setClipboard(text)
+}
+
+// runMacroMount reads credentials from the MOUNT_USER and MOUNT_PASSWORD
+// entries of the command env, so they can come from ${VARS} instead of args.
+func runMacroMount(ctx context.Context, cli CommandLine) error {
+	share := macroArg(cli, "share", 0)
+	target := macroArg(cli, "target", 1)
+	if _, ok := cli.options["share"]; ok {
+		target = macroArg(cli, "target", 0)
+	}
+	if share == "" || target == "" {
+		return errors.New("!MOUNT requires share and target")
+	}
+
+	user := os.ExpandEnv(cli.Env["MOUNT_USER"])
+	password := os.ExpandEnv(cli.Env["MOUNT_PASSWORD"])
+	return mountShare(share, target, user, password)
+}
+
+func runMacroUnmount(ctx context.Context, cli CommandLine) error {
+	if len(cli.Args) == 0 {
+		return errors.New("!UNMOUNT requires at least one target")
+	}
+
+	for _, target := range cli.Args {
+		err := unmountShare(target)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runQuiet(cmd *exec.Cmd) error {
+	out, err := cmd.CombinedOutput()
+	if err != nil && len(bytes.TrimSpace(out)) > 0 {
+		return fmt.Errorf("%s, %s", err, bytes.TrimSpace(out))
+	}
+	return err
+}
+
+// runMacroWaitNetwork waits until every condition holds. A condition is
+// host:port (TCP), host (ICMP), ssid:NAME or gateway:IP.
+func runMacroWaitNetwork(ctx context.Context, cli CommandLine) error {
+	if len(cli.Args) == 0 {
+		return errors.New("!WAIT_NETWORK requires at least one condition")
+	}
+
+	return waitFor(ctx, cli, time.Second, func() error {
+		for _, cond := range cli.Args {
+			if !networkReady(cond) {
+				return fmt.Errorf("%s not reachable", cond)
+			}
+		}
+		return nil
+	})
+}
+
+func networkReady(cond string) bool {
+	if strings.HasPrefix(cond, "ssid:") {
+		return currentSSID() == strings.TrimPrefix(cond, "ssid:")
+	}
+	if strings.HasPrefix(cond, "gateway:") {
+		return defaultGateway() == strings.TrimPrefix(cond, "gateway:")
+	}
+
+	if _, _, err := net.SplitHostPort(cond); err == nil {
+		conn, err := net.DialTimeout("tcp", cond, time.Second)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}
+	return pingHost(cond)
+}
+
+func runMacroWaitFileChanged(ctx context.Context, cli CommandLine) error {
+	name, pattern := macroArg(cli, "file", 0), macroArg(cli, "match", 1)
+	if _, ok := cli.options["file"]; ok {
+		pattern = macroArg(cli, "match", 0)
+	}
+	if name == "" {
+		return errors.New("!WAIT_FILE_CHANGED requires file and optional pattern")
+	}
+
+	var re *regexp.Regexp
+	if pattern != "" {
+		var err error
+		re, err = regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+	}
+
+	var since time.Time
+	if fi, err := os.Stat(name); err == nil {
+		since = fi.ModTime()
+	}
+
+	return waitFor(ctx, cli, time.Second/2, func() error {
+		if re != nil {
+			b, err := os.ReadFile(name)
+			if err == nil && re.Match(b) {
+				return nil
+			}
+		} else if fi, err := os.Stat(name); err == nil && !fi.ModTime().Equal(since) {
+			return nil
+		}
+		return errNotReady
+	})
+}
+
+func runMacroGitSync(ctx context.Context, cli CommandLine) error {
+	if len(cli.Args) == 0 {
+		return errors.New("!GIT_SYNC requires at least one repository")
+	}
+
+	var failed []string
+	for _, repo := range cli.Args {
+		logFor(cli).Info("sync: %s", repo)
+		err := runQuiet(exec.Command("git", "-C", repo, "fetch", "--prune"))
+		if err == nil {
+			err = runQuiet(exec.Command("git", "-C", repo, "pull", "--ff-only"))
+		}
+		if err != nil {
+			logFor(cli).Error("---> %s: %s", repo, err)
+			failed = append(failed, repo)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("sync failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func runMacroWaitDB(ctx context.Context, cli CommandLine) error {
+	if len(cli.Args) == 0 {
+		return errors.New("!WAIT_DB requires at least one DSN")
+	}
+	for _, dsn := range cli.Args {
+		err := checkDatabaseDSN(dsn)
+		if err != nil {
+			return err
+		}
+	}
+
+	return waitFor(ctx, cli, time.Second/2, func() error {
+		for _, dsn := range cli.Args {
+			err := pingDatabase(dsn)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func runMacroSound(ctx context.Context, cli CommandLine) error {
+	sound := "beep"
+	if len(cli.Args) > 0 {
+		sound = cli.Args[0]
+	}
+	return playSound(sound)
+}
+
+func runMacroWaitPidFile(ctx context.Context, cli CommandLine) error {
+	name := macroArg(cli, "file", 0)
+	if name == "" {
+		return errors.New("!WAIT_PID_FILE requires a pidfile")
+	}
+
+	var pid int
+	err := waitFor(ctx, cli, time.Second/2, func() error {
+		var err error
+		pid, err = readPidFile(name)
+		if err != nil {
+			return errNotReady
+		}
+		if !processAlive(pid) {
+			return fmt.Errorf("pid %d from %s is not running", pid, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if record, _ := strconv.ParseBool(cli.options["record"]); record {
+		logFor(cli).Info("record pid %d for cleanup", pid)
+		addManagedProcess(name, pid)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseMacroArgs(t *testing.T) {
+	params := waitParams("url", "match")
+	tests := []struct {
+		args    []string
+		want    []string
+		options map[string]string
+		err     string
+	}{
+		{args: []string{"http://localhost", "status==ok"}, want: []string{"http://localhost", "status==ok"}},
+		{args: []string{"http://localhost", "status!=down"}, want: []string{"http://localhost", "status!=down"}},
+		{args: []string{"http://localhost", "body~=ready"}, want: []string{"http://localhost", "body~=ready"}},
+		{args: []string{"url=http://localhost", "status==ok"}, want: []string{"status==ok"}, options: map[string]string{"url": "http://localhost"}},
+		{args: []string{"http://localhost", "ok", "timeout=5s"}, want: []string{"http://localhost", "ok"}, options: map[string]string{"timeout": "5s"}},
+		{args: []string{"http://localhost", "ok", "timout=5s"}, err: "unknown option timout"},
+		{args: []string{"http://localhost", "ok", "timeout=5s", "timeout=1s"}, err: "more than once"},
+		{args: []string{"http://localhost", "ok", "timeout=soon"}, err: "invalid timeout"},
+	}
+
+	for _, tt := range tests {
+		cli, err := parseMacroArgs(CommandLine{Command: "!WAIT_URL_CONTENT", Args: tt.args}, params)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%q: got error %v, want %q", tt.args, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", tt.args, err)
+			continue
+		}
+		if strings.Join(cli.Args, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%q: got args %q, want %q", tt.args, cli.Args, tt.want)
+		}
+		for k, v := range tt.options {
+			if cli.options[k] != v {
+				t.Errorf("%q: got %s=%q, want %q", tt.args, k, cli.options[k], v)
+			}
+		}
+	}
+}
+
+func TestWaitURLContentNamedURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer server.Close()
+
+	for _, args := range [][]string{
+		{server.URL, "status==ok"},
+		{"url=" + server.URL, "status==ok"},
+		{"status==ok", "url=" + server.URL},
+	} {
+		cli, err := parseMacroArgs(CommandLine{Command: "!WAIT_URL_CONTENT", Args: append(args, "timeout=2s")}, waitParams("url", "match"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = runMacroWaitURLContent(context.Background(), cli)
+		if err != nil {
+			t.Errorf("%q: %s", args, err)
+		}
+	}
+}
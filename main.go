@@ -1,19 +1,27 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"net"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"reflect"
+	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"golang.design/x/hotkey"
@@ -24,68 +32,601 @@ import (
 
 type (
 	CommandLine struct {
-		Command     string        `json:"command"`
-		Args        []string      `json:"args,omitempty"`
-		IgnoreError bool          `json:"ignore_error,omitempty"`
-		Background  bool          `json:"background,omitempty"`
-		NullStdout  bool          `json:"null_stdout,omitempty"`
-		Timeout     time.Duration `json:"timeout,omitempty"`
+		Name        string            `json:"name,omitempty"`
+		Command     string            `json:"command"`
+		Args        []string          `json:"args,omitempty"`
+		Dir         string            `json:"dir,omitempty"`
+		Env         map[string]string `json:"env,omitempty"`
+		IgnoreError bool              `json:"ignore_error,omitempty"`
+		Background  bool              `json:"background,omitempty"`
+		NullStdout  bool              `json:"null_stdout,omitempty"`
+		Timeout     time.Duration     `json:"timeout,omitempty"`
+		Confirm     bool              `json:"confirm,omitempty"`
+		OnFailure   []CommandLine     `json:"on_failure,omitempty"`
+		Teardown    []CommandLine     `json:"teardown,omitempty"`
+		Template    string            `json:"template,omitempty"`
+		Params      map[string]string `json:"params,omitempty"`
+
+		// restart policy for background commands: no, on-failure or always
+		Restart       string        `json:"restart,omitempty"`
+		MaxRestarts   int           `json:"max_restarts,omitempty"`
+		RestartWindow time.Duration `json:"restart_window,omitempty"`
+
+		// cleanup stops a background command before the ones it depends on,
+		// waiting StopTimeout seconds (default 5) before killing it
+		DependsOn   []string      `json:"depends_on,omitempty"`
+		StopTimeout time.Duration `json:"stop_timeout,omitempty"`
+
+		Health *Probe `json:"health,omitempty"`
+		Ready  *Probe `json:"ready,omitempty"`
+
+		options map[string]string
+	}
+
+	Stage struct {
+		Name     string        `json:"name"`
+		Parallel bool          `json:"parallel,omitempty"`
+		Commands []CommandLine `json:"commands"`
 	}
 
 	Config struct {
-		Startup  []CommandLine `json:"startup"`
-		Cleanup  []CommandLine `json:"cleanup"`
-		ShowApps []string      `json:"show_apps"`
-		HideApps []string      `json:"hide_apps"`
+		Schema   int               `json:"schema,omitempty"`
+		Startup  []CommandLine     `json:"startup"`
+		Stages   []Stage           `json:"stages,omitempty"`
+		Cleanup  []CommandLine     `json:"cleanup"`
+		ShowApps []AppSpec         `json:"show_apps"`
+		HideApps []AppSpec         `json:"hide_apps"`
+		HotKeys  map[string]string `json:"hotkeys,omitempty"`
+
+		Templates  map[string]CommandLine   `json:"templates,omitempty"`
+		CleanRoots []string                 `json:"clean_roots,omitempty"`
+		Macros     map[string][]CommandLine `json:"macros,omitempty"`
+		Tasks      map[string][]CommandLine `json:"tasks,omitempty"`
+		Control    *ControlConfig           `json:"control,omitempty"`
+		MQTT       *MQTTConfig              `json:"mqtt,omitempty"`
+		Webhooks   []Webhook                `json:"webhooks,omitempty"`
+		Triggers   []Trigger                `json:"triggers,omitempty"`
+		Schedules  map[string]string        `json:"schedules,omitempty"`
+		Notify     *bool                    `json:"notify,omitempty"`
+		Logs       *LogsConfig              `json:"logs,omitempty"`
+		Monitor    *MonitorConfig           `json:"monitor,omitempty"`
+		Log        *LogConfig               `json:"log,omitempty"`
+		Tracing    *TracingConfig           `json:"tracing,omitempty"`
+		Alerts     []Alert                  `json:"alerts,omitempty"`
+
+		// StartupTimeout, in seconds, aborts startup as a whole
+		StartupTimeout time.Duration `json:"startup_timeout,omitempty"`
+
+		// CleanupAfterRollback runs cleanup after a failed startup even
+		// when startup steps have teardowns to undo it
+		CleanupAfterRollback bool `json:"cleanup_after_rollback,omitempty"`
+	}
+
+	StepResult struct {
+		Name     string
+		Status   string
+		Start    time.Time
+		Duration time.Duration
+		Err      error
+		Ignored  bool
+		ExitCode int
+		Retries  int
+	}
+
+	RunReport struct {
+		Title     string
+		Start     time.Time
+		End       time.Time
+		Err       error
+		Steps     []*StepResult
+		completed []CommandLine
+		mu        sync.Mutex
 	}
 
 	HotKey struct {
 		Name   string
 		Handle *hotkey.Hotkey
+		Run    func()
+	}
+
+	// cleanupRun is one run of cleanup, shared by every caller that asks
+	// for it while it runs or before anything else is started
+	cleanupRun struct {
+		done chan struct{}
+		err  error
 	}
 )
 
 var (
 	listenKeys   []*HotKey
-	globalCfg    *Config
+	configDir    string
 	cleanupMutex sync.Mutex
+	lastCleanup  *cleanupRun
+	cancelMutex  sync.Mutex
+	runCancel    context.CancelFunc
+	confirmMutex sync.Mutex
+	runMutex     sync.Mutex
+	dryRun       bool
+
+	errSkipped = errors.New("skipped")
+)
+
+// Exit codes, so wrapper scripts can tell why safework ended. A signal
+// exits with 128 plus its number once cleanup succeeds.
+const (
+	exitOK        = 0 // cleanup was asked for and succeeded
+	exitError     = 1 // anything else, such as a crash
+	exitConfig    = 2 // commands.json or the log settings are invalid
+	exitHotKey    = 3 // a hotkey could not be registered
+	exitStartup   = 4 // startup failed, or a server could not start
+	exitCleanup   = 5 // cleanup had failures
+	exitDuplicate = 6 // another instance runs for this config
 )
 
 func main() {
-	err := loadConfig()
+	if isStreamDeckLaunch(os.Args[1:]) {
+		os.Exit(runStreamDeck(os.Args[1:]))
+	}
+
+	flag.BoolVar(&dryRun, "dry-run", false, "print startup and cleanup commands without executing them")
+	flag.BoolVar(&trayMode, "tray", false, "run with a tray icon, logging to safework.log in the config dir")
+	flag.StringVar(&flagLevel, "log-level", "", "show log entries from this level up: trace, debug, info, warn or error")
+	flag.StringVar(&flagFormat, "log-format", "", "log as text or json")
+	flag.StringVar(&flagLogFile, "log-file", "", "also write the console to this file, rotated at 10 MB")
+	flag.BoolVar(&flagVerbose, "v", false, "show details like resolved paths and environment")
+	flag.BoolVar(&flagVeryVerbose, "vv", false, "show details and every polling attempt of wait macros")
+	flag.BoolVar(&flagQuiet, "q", false, "show only failures and summaries")
+	flag.BoolVar(&flagNoColor, "no-color", false, "don't color statuses, also set by NO_COLOR")
+	showVersion := flag.Bool("version", false, "print the version and build info")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *showVersion {
+		os.Exit(runVersionCommand(nil))
+	}
+
+	args := flag.Args()
+	if len(args) > 0 {
+		if client, ok := clientCommands[args[0]]; ok {
+			flag.CommandLine.Parse(args[1:])
+			os.Exit(client(flag.Args()))
+		}
+		if args[0] == "serve" {
+			os.Exit(runServe(args[1:]))
+		}
+		if args[0] == "service" {
+			os.Exit(runService(args[1:]))
+		}
+		if args[0] == "systemd" {
+			os.Exit(runSystemd(args[1:]))
+		}
+		if args[0] == "launchd" {
+			os.Exit(runLaunchd(args[1:]))
+		}
+		if args[0] == "logs" {
+			os.Exit(runLogsCommand(args[1:]))
+		}
+		if args[0] == "autostart" {
+			os.Exit(runAutostart(args[1:]))
+		}
+		if args[0] == "version" {
+			os.Exit(runVersionCommand(args[1:]))
+		}
+		if args[0] == "completion" {
+			os.Exit(runCompletion(args[1:]))
+		}
+		if args[0] == "__complete" {
+			os.Exit(runCompleteNames(args[1:]))
+		}
+		if args[0] == "start" || args[0] == "resume" {
+			resumeMode = args[0] == "resume"
+			flag.CommandLine.Parse(args[1:])
+		}
+	}
+	start(flag.Arg(0))
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "usage: safework [start|resume] [flags] [config dir]")
+	fmt.Fprintln(out, "       safework stop|status|ps|reload|tui [config dir]")
+	fmt.Fprintln(out, "       safework run <task|startup|cleanup> [config dir]")
+	fmt.Fprintln(out, "       safework trigger <action> [config dir]")
+	fmt.Fprintln(out, "       safework logs [-f] [-n lines] <name> [config dir]")
+	fmt.Fprintln(out, "       safework serve --stdio [config dir]")
+	fmt.Fprintln(out, "       safework service install|uninstall|run [config dir]")
+	fmt.Fprintln(out, "       safework systemd install [config dir]")
+	fmt.Fprintln(out, "       safework launchd install [config dir]")
+	fmt.Fprintln(out, "       safework autostart enable|disable [--tray] [config dir]")
+	fmt.Fprintln(out, "       safework completion bash|zsh|fish|powershell")
+	fmt.Fprintln(out, "       safework version")
+	fmt.Fprintln(out)
+	flag.PrintDefaults()
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "exit codes:")
+	fmt.Fprintln(out, "  0  cleanup succeeded")
+	fmt.Fprintln(out, "  2  invalid config")
+	fmt.Fprintln(out, "  3  hotkey registration failed")
+	fmt.Fprintln(out, "  4  startup failed")
+	fmt.Fprintln(out, "  5  cleanup failed")
+	fmt.Fprintln(out, "  6  already running")
+	fmt.Fprintln(out, "  128+n  stopped by signal n")
+}
+
+func start(dir string) {
+	err := loadConfig(dir)
 	if err != nil {
 		fmt.Println(err)
 		fmt.Scanln()
-		os.Exit(1)
+		exit(exitConfig)
+	}
+
+	if dryRun {
+		fmt.Println("[DRY RUN STARTUP COMMANDS]")
+		printCommands(config().Startup, "")
+		for _, stage := range config().Stages {
+			fmt.Println()
+			if stage.Parallel {
+				fmt.Printf("[DRY RUN STAGE %s (parallel)]\n", stage.Name)
+			} else {
+				fmt.Printf("[DRY RUN STAGE %s]\n", stage.Name)
+			}
+			printCommands(stage.Commands, "")
+		}
+		for _, name := range taskNames() {
+			fmt.Println()
+			fmt.Printf("[DRY RUN TASK %s]\n", name)
+			printCommands(config().Tasks[name], "")
+		}
+		fmt.Println()
+		fmt.Println("[DRY RUN CLEANUP COMMANDS]")
+		printCommands(config().Cleanup, "")
+		return
+	}
+
+	err = setupLogging(config().Log)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		exit(exitConfig)
+	}
+	logDebug("config: %s", filepath.Join(configDir, "commands.json"))
+
+	err = lockInstance()
+	if err != nil {
+		logError("ERR: %s", err)
+		var ping struct{ Pid int }
+		if b, err := ipcCall(configDir, "ping"); err == nil && json.Unmarshal(b, &ping) == nil {
+			logError("running instance: pid %d", ping.Pid)
+		}
+		logError("use `safework status` or `safework stop`")
+		exit(exitDuplicate)
+	}
+
+	if path := configuredLogFile(); path != "" {
+		err = openLogFile(path)
+		if err != nil {
+			logError("ERR: %s", err)
+			exit(exitConfig)
+		}
 	}
 
 	handleInterrupt()
+	startWatchdog()
 
 	err = regHotKeys()
 	if err != nil {
 		fmt.Scanln()
-		os.Exit(1)
+		exit(exitHotKey)
 	}
-
-	fmt.Println()
-	fmt.Println("[RUN STARTUP COMMANDS]")
-	err = runCommands(globalCfg.Startup, false)
+	err = startServers()
 	if err != nil {
-		cleanup()
 		fmt.Scanln()
-		os.Exit(1)
+		exit(exitStartup)
 	}
 
-	mainthread.Init(listenHotKeys)
+	resumed := recoverState(resumeMode)
+	if trayMode {
+		runTray(!resumed)
+		return
+	}
+
+	// hotkeys work during startup, so cleanup can cut it short
+	mainthread.Init(func() {
+		if !resumed {
+			go runConsoleStartup()
+		}
+		listenHotKeys()
+	})
 }
 
-func cleanup() {
-	if cleanupMutex.TryLock() {
-		fmt.Println()
-		fmt.Println("[RUN CLEANUP COMMANDS]")
-		runCommands(globalCfg.Cleanup, true)
+func runConsoleStartup() {
+	defer recoverPanic()
+	report, err := runStartup()
+	if err == nil || errors.Is(err, errCanceled) {
+		// canceled by cleanup, which exits when done
+		return
+	}
+
+	code := exitStartup
+	if rollbackStartup(report) != nil {
+		code = exitCleanup
+	}
+	fmt.Scanln()
+	exit(code)
+}
+
+// startServers starts every remote interface and watcher the config
+// enables.
+func startServers() error {
+	err := startIPCServer()
+	if err == nil {
+		err = startControlServer()
+	}
+	if err == nil {
+		err = startGRPCServer()
+	}
+	if err == nil {
+		err = startMQTT()
+	}
+	if err == nil {
+		err = startTriggers()
+	}
+	if err == nil {
+		startScheduler()
+		startMonitor()
+	}
+	return err
+}
+
+func runStartup() (*RunReport, error) {
+	runMutex.Lock()
+	defer runMutex.Unlock()
+
+	rearmCleanup()
+	logSection("[RUN STARTUP COMMANDS]")
+	report := newRunReport("STARTUP")
+	recordReport("", report)
+	setTrayState(trayStarting)
+	ctx, done := beginRun()
+	defer done()
+	timeout := config().StartupTimeout * time.Second
+	if timeout > 0 {
+		ctx, done = context.WithTimeout(ctx, timeout)
+		defer done()
+	}
+	err := runCommands(ctx, config().Startup, false, report)
+	if err == nil {
+		err = runStages(ctx, config().Stages, report)
+	}
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("startup timed out after %s", timeout)
+		logError("ERR: %s", err)
+	}
+	report.Finish(err)
+	postAsync(func() { exportTrace(report) })
+	failed, total := report.Counts()
+	if err != nil {
+		setTrayState(trayFailed)
+		sdNotify("STATUS=startup failed")
+		msg := fmt.Sprintf("%d of %d steps failed: %s", failed, total, err)
+		sendNotification("safework startup failed", msg)
+		postAsync(func() { sendAlert("startup_failed", "safework startup failed", msg) })
+	} else {
+		setTrayState(trayReady)
+		sdNotify("READY=1\nSTATUS=startup complete")
+		sendNotification("safework startup finished", fmt.Sprintf("%d steps, %d failed", total, failed))
+	}
+	report.Print()
+	return report, err
+}
+
+// sendNotification shows a desktop notification unless "notify" is false.
+func sendNotification(title, message string) {
+	if config().Notify != nil && !*config().Notify {
+		return
+	}
+
+	go func() {
+		err := notify(title, message)
+		if err != nil {
+			logError("ERR: notify, %s", err)
+		}
+	}()
+}
+
+func runTask(name string) (*RunReport, error) {
+	commands, ok := config().Tasks[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown task %s", name)
+	}
+
+	runMutex.Lock()
+	defer runMutex.Unlock()
+
+	rearmCleanup()
+	logSection("[RUN TASK %s]", name)
+	report := newRunReport("TASK " + name)
+	recordReport(name, report)
+	ctx, done := beginRun()
+	defer done()
+	err := runCommands(ctx, commands, false, report)
+	report.Finish(err)
+	postAsync(func() { exportTrace(report) })
+	report.Print()
+	return report, err
+}
+
+func taskNames() []string {
+	names := []string{}
+	for name := range config().Tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reloadConfig re-reads commands.json. Hotkeys and the control API keep
+// their old bindings until restart.
+func reloadConfig() error {
+	runMutex.Lock()
+	defer runMutex.Unlock()
+
+	err := loadConfig(configDir)
+	if err != nil {
+		return err
+	}
+	logSection("[CONFIG RELOADED]")
+	return nil
+}
+
+// cleanup runs every cleanup step even if some fail, and returns an error
+// when one without ignore_error did. It runs once: callers that come while
+// it runs wait for it, and later ones get the same result until startup
+// or a task runs again.
+func cleanup() error {
+	return cleanupOnce(runCleanup)
+}
+
+func cleanupOnce(run func() error) error {
+	cancelRun()
+
+	cleanupMutex.Lock()
+	last := lastCleanup
+	if last != nil {
 		cleanupMutex.Unlock()
+		<-last.done
+		return last.err
 	}
+	last = &cleanupRun{done: make(chan struct{})}
+	lastCleanup = last
+	cleanupMutex.Unlock()
+
+	// the error stays if run panics
+	defer close(last.done)
+	last.err = errors.New("cleanup did not finish")
+	last.err = run()
+	return last.err
+}
+
+// recoverPanic, deferred at the top of a goroutine, logs the stack of a
+// panic and runs cleanup before exiting, so background processes don't
+// leak.
+func recoverPanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	defer func() {
+		// cleanup panicked too
+		recover()
+		exit(exitError)
+	}()
+
+	logError("[PANIC] %v\n%s", r, debug.Stack())
+	cleanup()
+}
+
+// beginRun starts the context of a startup or task run, which cleanup
+// cancels to stop waits that are still going.
+func beginRun() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelMutex.Lock()
+	runCancel = cancel
+	cancelMutex.Unlock()
+	return ctx, cancel
+}
+
+func cancelRun() {
+	cancelMutex.Lock()
+	if runCancel != nil {
+		runCancel()
+	}
+	cancelMutex.Unlock()
+}
+
+// rearmCleanup lets the next cleanup run again, once there is something
+// new to clean up.
+func rearmCleanup() {
+	cleanupMutex.Lock()
+	if lastCleanup != nil {
+		select {
+		case <-lastCleanup.done:
+			lastCleanup = nil
+		default:
+		}
+	}
+	cleanupMutex.Unlock()
+}
+
+// exitAfterCleanup runs cleanup and exits with code, or exitCleanup if
+// cleanup failed.
+func exitAfterCleanup(code int) {
+	if cleanup() != nil {
+		code = exitCleanup
+	}
+	exit(code)
+}
+
+func runCleanup() error {
+	logSection("[RUN CLEANUP COMMANDS]")
+	report := newRunReport("CLEANUP")
+	runCommands(context.Background(), config().Cleanup, true, report)
+	stopManagedProcesses()
+	report.Finish(nil)
+	report.Print()
+	// not in the background, the process exits after cleanup
+	exportTrace(report)
+
+	failed, total := report.Counts()
+	if report.Failed() {
+		sendAlert("cleanup", "safework cleanup failed", fmt.Sprintf("%d of %d steps failed", failed, total))
+		return fmt.Errorf("%d of %d cleanup steps failed", failed, total)
+	}
+	sendAlert("cleanup", "safework cleanup finished", fmt.Sprintf("%d steps, %d failed", total, failed))
+	return nil
+}
+
+func rollback(report *RunReport) {
+	steps := report.Completed()
+	if len(steps) == 0 {
+		return
+	}
+
+	logSection("[ROLLBACK STARTED STEPS]")
+	for i := len(steps) - 1; i >= 0; i-- {
+		logFor(steps[i]).Info("teardown: %s", commandName(steps[i]))
+		runCommands(context.Background(), steps[i].Teardown, true, nil)
+	}
+}
+
+// rollbackStartup undoes a failed startup. When startup steps have
+// teardowns, they undo what was started and the cleanup commands, which
+// may expect everything to be up, are skipped unless
+// cleanup_after_rollback is set. Later cleanups don't run them either.
+func rollbackStartup(report *RunReport) error {
+	rollback(report)
+	if config().CleanupAfterRollback || !startupHasTeardown() {
+		return cleanup()
+	}
+	return cleanupOnce(func() error {
+		logInfo("rolled back by teardowns, skip cleanup commands")
+		stopManagedProcesses()
+		return nil
+	})
+}
+
+func startupHasTeardown() bool {
+	commands := append([]CommandLine(nil), config().Startup...)
+	for _, stage := range config().Stages {
+		commands = append(commands, stage.Commands...)
+	}
+	for _, cli := range commands {
+		cli, err := resolveTemplate(cli)
+		if err == nil && len(cli.Teardown) > 0 {
+			return true
+		}
+	}
+	return false
 }
 
 func handleInterrupt() {
@@ -93,23 +634,41 @@ func handleInterrupt() {
 	wg.Add(1)
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	// launchd and service managers stop agents with SIGTERM, closing the
+	// terminal sends SIGHUP
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	handleConsoleClose()
 
 	go func() {
 		wg.Done()
-		<-c
-		cleanup()
-		os.Exit(1)
+		sig := <-c
+		logInfo("")
+		logWarn("[SIGNAL %s]", sig)
+		exitAfterCleanup(signalExitCode(sig))
 	}()
 }
 
-func loadConfig() error {
+// signalExitCode follows the shell convention of 128 plus the signal
+// number, 130 for ctrl+c and 143 for SIGTERM.
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return exitError
+}
+
+func resolveConfigDir(arg string) string {
 	var wd string
 
-	if len(os.Args) > 1 {
-		wd = os.Args[1] + string(os.PathSeparator)
+	if arg != "" {
+		wd = arg + string(os.PathSeparator)
 	}
 	dir, _ := filepath.Abs(filepath.Dir(wd))
+	return dir
+}
+
+func loadConfig(arg string) error {
+	dir := resolveConfigDir(arg)
 
 	f, err := os.Open(filepath.Join(dir, "commands.json"))
 	if err != nil {
@@ -122,42 +681,162 @@ func loadConfig() error {
 		return err
 	}
 
-	globalCfg = &Config{}
-	err = json.Unmarshal(b, globalCfg)
+	cfg := &Config{}
+	err = json.Unmarshal(b, cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.Schema > configSchema {
+		return fmt.Errorf("config schema %d needs a newer safework, this one reads up to %d", cfg.Schema, configSchema)
+	}
+
+	macros := make(map[string][]CommandLine, len(cfg.Macros))
+	for name, steps := range cfg.Macros {
+		name = strings.ToUpper(name)
+		if !strings.HasPrefix(name, "!") {
+			name = "!" + name
+		}
+		macros[name] = steps
+	}
+	cfg.Macros = macros
+
+	err = checkMacroCycles(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = checkCommands(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range cfg.Webhooks {
+		if _, ok := cfg.Tasks[hook.Task]; !ok {
+			return fmt.Errorf("webhook %s: unknown task %s", hook.Name, hook.Task)
+		}
+	}
+
+	err = checkDependencies(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = checkTriggers(cfg)
 	if err != nil {
 		return err
 	}
 
+	err = checkSchedules(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = checkAlerts(cfg.Alerts)
+	if err != nil {
+		return err
+	}
+
+	setConfig(cfg)
+	// reload keeps the dir, don't write what other goroutines read
+	if configDir != dir {
+		configDir = dir
+	}
 	return nil
 }
 
-func regHotKeys() error {
-	err := regHotKey("CTL + SHIFT + ALT + X", hotkey.KeyX, hotkey.ModCtrl, hotkey.ModShift, hotkey.ModAlt)
-	if err != nil {
+// checkDependencies makes sure depends_on names a command in the config.
+func checkDependencies(cfg *Config) error {
+	lists := [][]CommandLine{cfg.Startup}
+	for _, stage := range cfg.Stages {
+		lists = append(lists, stage.Commands)
+	}
+	for _, cmds := range cfg.Tasks {
+		lists = append(lists, cmds)
+	}
+
+	names := make(map[string]bool)
+	for _, cmds := range lists {
+		for _, cli := range cmds {
+			names[commandName(cli)] = true
+		}
+	}
+	for _, cmds := range lists {
+		for _, cli := range cmds {
+			for _, dep := range cli.DependsOn {
+				if !names[dep] {
+					return fmt.Errorf("%s: depends_on unknown command %s", commandName(cli), dep)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func checkMacroCycles(cfg *Config) error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+
+	var visit func(name string) error
+	var visitSteps func(steps []CommandLine) error
+	visitSteps = func(steps []CommandLine) error {
+		for _, step := range steps {
+			if _, ok := cfg.Macros[strings.ToUpper(step.Command)]; ok {
+				err := visit(strings.ToUpper(step.Command))
+				if err != nil {
+					return err
+				}
+			}
+			err := visitSteps(step.OnFailure)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("macro %s references itself", name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		err := visitSteps(cfg.Macros[name])
+		state[name] = visited
 		return err
 	}
+
+	for name := range cfg.Macros {
+		err := visit(name)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func regHotKey(name string, key hotkey.Key, mods ...hotkey.Modifier) error {
+func regHotKey(name string, run func(), key hotkey.Key, mods ...hotkey.Modifier) error {
 	ms := []hotkey.Modifier{}
 	ms = append(ms, mods...)
 	hk := hotkey.New(ms, key)
 
 	err := hk.Register()
 	if err != nil {
-		fmt.Printf("ERR: register hotkey %s failed, %s\n", name, err)
+		logError("ERR: register hotkey %s failed, %s", name, err)
 		return err
 	}
 
-	fmt.Printf("[REGISTER HOTKEY] %s ok\n", name)
-	listenKeys = append(listenKeys, &HotKey{Name: name, Handle: hk})
+	logInfo("[REGISTER HOTKEY] %s ok", name)
+	listenKeys = append(listenKeys, &HotKey{Name: name, Handle: hk, Run: run})
 	return nil
 }
 
 func listenHotKeys() {
-	fmt.Println()
-	fmt.Println("[LISTENING HOT KEYS]")
+	defer recoverPanic()
+	logSection("[LISTENING HOT KEYS]")
 	cases := make([]reflect.SelectCase, len(listenKeys))
 	for i, reg := range listenKeys {
 		cases[i] = reflect.SelectCase{
@@ -172,21 +851,194 @@ func listenHotKeys() {
 			break
 		}
 
-		switch chosen {
-		case 0:
-			fmt.Println("[RUN CLEANUP COMMANDS]")
-			runCommands(globalCfg.Cleanup, true)
-			os.Exit(0)
+		if atomic.LoadInt32(&hotKeysPaused) != 0 {
+			logInfo("[HOTKEY PAUSED] %s", listenKeys[chosen].Name)
+			continue
 		}
+
+		publishEvent(Event{Type: "hotkey", Name: listenKeys[chosen].Name})
+		countHotKey(listenKeys[chosen].Name)
+		listenKeys[chosen].Run()
+	}
+}
+
+func newRunReport(title string) *RunReport {
+	return &RunReport{Title: title, Start: time.Now()}
+}
+
+// StartStep records a step as running, EndStep fills in how it went.
+func (r *RunReport) StartStep(name string) *StepResult {
+	if r == nil {
+		return nil
+	}
+
+	step := &StepResult{Name: name, Status: "running", Start: time.Now()}
+	r.mu.Lock()
+	r.Steps = append(r.Steps, step)
+	r.mu.Unlock()
+	return step
+}
+
+func (r *RunReport) EndStep(step *StepResult, name string, err error, ignored bool, retries int) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	step.Name, step.Duration, step.Err, step.Ignored = name, time.Since(step.Start), err, ignored
+	step.ExitCode, step.Retries = exitCode(err), retries
+	step.Status = "ok"
+	if err == errSkipped {
+		step.Status = "skipped"
+		step.Err = nil
+	} else if err != nil {
+		step.Status = "failed"
 	}
 }
 
-func runCommands(commands []CommandLine, ignoreErrors bool) error {
+// Skip records commands that never ran because the run was stopped.
+func (r *RunReport) Skip(commands []CommandLine) {
 	for _, cli := range commands {
-		err := runCommand(cli)
+		r.EndStep(r.StartStep(commandName(cli)), commandName(cli), errSkipped, false, 0)
+	}
+}
+
+func (r *RunReport) Finish(err error) {
+	r.mu.Lock()
+	r.End, r.Err = time.Now(), err
+	r.mu.Unlock()
+}
+
+// Counts returns the failed steps, ignored errors included, and all steps.
+func (r *RunReport) Counts() (failed, total int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, step := range r.Steps {
+		if step.Status == "failed" {
+			failed++
+		}
+	}
+	return failed, len(r.Steps)
+}
+
+// Failed reports whether a step without ignore_error failed.
+func (r *RunReport) Failed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.Err != nil {
+		return true
+	}
+	for _, step := range r.Steps {
+		if step.Status == "failed" && !step.Ignored {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RunReport) Done(cli CommandLine) {
+	if r == nil || len(cli.Teardown) == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	r.completed = append(r.completed, cli)
+	r.mu.Unlock()
+}
+
+func (r *RunReport) Completed() []CommandLine {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]CommandLine(nil), r.completed...)
+}
+
+// Print shows each step, with the errors of failed ones, and the counts.
+func (r *RunReport) Print() {
+	failed := r.Failed()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counts := make(map[string]int)
+	var b bytes.Buffer
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\tDURATION\tERROR")
+	for _, step := range r.Steps {
+		counts[step.Status]++
+		var msg string
+		if step.Err != nil {
+			msg = step.Err.Error()
+			if step.Ignored {
+				msg += " (ignored)"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", step.Name, step.Status, step.Duration.Round(time.Millisecond), msg)
+	}
+	fmt.Fprintf(w, "total\t\t%s\t\n", time.Since(r.Start).Round(time.Millisecond))
+	w.Flush()
+
+	// color after the layout, so escape codes don't count as width
+	lines := strings.Split(strings.TrimRight(b.String(), "\n"), "\n")
+	col := strings.Index(lines[0], "STATUS")
+	for i := range lines {
+		if i > 0 && i <= len(r.Steps) {
+			status := r.Steps[i-1].Status
+			lines[i] = lines[i][:col] + colorStatus(status) + lines[i][col+len(status):]
+		}
+		lines[i] = strings.TrimRight(lines[i], " ")
+	}
+	lines = append(lines, fmt.Sprintf("%d steps: %d %s, %d %s, %d %s", len(r.Steps),
+		counts["ok"], colorStatus("ok"), counts["failed"], colorStatus("failed"), counts["skipped"], colorStatus("skipped")))
+	logSummary(failed, r.Title, strings.Join(lines, "\n"))
+}
+
+func commandName(cli CommandLine) string {
+	if cli.Name != "" {
+		return cli.Name
+	}
+	if cli.Command == "" && cli.Template != "" {
+		return cli.Template
+	}
+	return cli.Command
+}
+
+func runCommands(ctx context.Context, commands []CommandLine, ignoreErrors bool, report *RunReport) error {
+	for i, cli := range commands {
+		if ctx.Err() != nil {
+			report.Skip(commands[i:])
+			return contextError(ctx)
+		}
+		start := time.Now()
+		step := report.StartStep(commandName(cli))
+		publishEvent(Event{Type: "started", Name: commandName(cli)})
+		cli, err := resolveTemplate(cli)
+		if err == nil {
+			err = runCommand(ctx, cli)
+		}
+		if err != nil && err != errSkipped && len(cli.OnFailure) > 0 {
+			logFor(cli).Error("---> %s", err)
+			logFor(cli).Info("run on_failure: %s", commandName(cli))
+			err = runCommands(ctx, cli.OnFailure, false, nil)
+		}
+		report.EndStep(step, commandName(cli), err, cli.IgnoreError, takeRetries(commandName(cli)))
+		publishFinished(commandName(cli), time.Since(start), err)
+		observeCommand(commandName(cli), time.Since(start), err)
+		if err == errSkipped {
+			continue
+		}
+		if err == nil {
+			report.Done(cli)
+		}
 		if err != nil {
-			fmt.Printf("---> %s\n", err)
-			if !ignoreErrors {
+			logFor(cli).Error("---> %s", err)
+			if !ignoreErrors && !cli.IgnoreError {
+				if ctx.Err() != nil {
+					report.Skip(commands[i+1:])
+				}
 				return err
 			}
 		}
@@ -194,108 +1046,386 @@ func runCommands(commands []CommandLine, ignoreErrors bool) error {
 	return nil
 }
 
-func runCommand(cli CommandLine) error {
-	if cli.Command[0] == '!' {
-		return runMacro(cli)
+func runStages(ctx context.Context, stages []Stage, report *RunReport) error {
+	for _, stage := range stages {
+		logSection("[RUN STAGE %s]", stage.Name)
+
+		var err error
+		if stage.Parallel {
+			err = runParallel(ctx, stage.Commands, report)
+		} else {
+			err = runCommands(ctx, stage.Commands, false, report)
+		}
+		if err != nil {
+			return fmt.Errorf("stage %s failed, %w", stage.Name, err)
+		}
 	}
+	return nil
+}
 
-	fmt.Printf("run: %s %s\n", cli.Command, strings.Join(cli.Args, " "))
-	cmd := exec.Command(cli.Command, cli.Args...)
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
+func runParallel(ctx context.Context, commands []CommandLine, report *RunReport) error {
+	errs := make([]error, len(commands))
+	wg := sync.WaitGroup{}
+	for i, cli := range commands {
+		wg.Add(1)
+		go func(i int, cli CommandLine) {
+			defer wg.Done()
+			errs[i] = runCommands(ctx, []CommandLine{cli}, false, report)
+		}(i, cli)
 	}
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return err
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
 	}
-	err = cmd.Start()
-	if err != nil {
-		return err
+	return nil
+}
+
+func printCommands(commands []CommandLine, indent string) {
+	for _, cli := range commands {
+		cli, err := resolveTemplate(cli)
+		if err != nil {
+			fmt.Printf("%s---> %s\n", indent, err)
+			continue
+		}
+
+		cli = expandCommand(cli)
+		if isMacro(cli) {
+			fmt.Printf("%smacro: %s %s\n", indent, cli.Command, strings.Join(cli.Args, " "))
+		} else {
+			fmt.Printf("%srun: %s %s\n", indent, cli.Command, strings.Join(cli.Args, " "))
+		}
+
+		dir := cli.Dir
+		if dir == "" {
+			dir, _ = os.Getwd()
+		}
+		fmt.Printf("%s  cwd: %s\n", indent, dir)
+		for _, kv := range commandEnv(cli) {
+			fmt.Printf("%s  env: %s\n", indent, maskEnv(kv))
+		}
+
+		var opts []string
+		if cli.Background {
+			opts = append(opts, "background")
+		}
+		if cli.IgnoreError {
+			opts = append(opts, "ignore_error")
+		}
+		if cli.NullStdout {
+			opts = append(opts, "null_stdout")
+		}
+		if cli.Timeout > 0 {
+			opts = append(opts, fmt.Sprintf("timeout=%ds", cli.Timeout))
+		}
+		if cli.Confirm {
+			opts = append(opts, "confirm")
+		}
+		if cli.Restart != "" {
+			opts = append(opts, "restart="+cli.Restart)
+		}
+		if cli.MaxRestarts > 0 {
+			opts = append(opts, fmt.Sprintf("max_restarts=%d", cli.MaxRestarts))
+		}
+		if cli.RestartWindow > 0 {
+			opts = append(opts, fmt.Sprintf("restart_window=%ds", cli.RestartWindow))
+		}
+		if len(cli.DependsOn) > 0 {
+			opts = append(opts, "depends_on="+strings.Join(cli.DependsOn, ","))
+		}
+		if cli.StopTimeout > 0 {
+			opts = append(opts, fmt.Sprintf("stop_timeout=%ds", cli.StopTimeout))
+		}
+		if cli.Health != nil {
+			opts = append(opts, "health")
+		}
+		if cli.Ready != nil {
+			opts = append(opts, "ready")
+		}
+		if len(opts) > 0 {
+			fmt.Printf("%s  options: %s\n", indent, strings.Join(opts, ", "))
+		}
+
+		if len(cli.OnFailure) > 0 {
+			fmt.Printf("%s  on_failure:\n", indent)
+			printCommands(cli.OnFailure, indent+"    ")
+		}
+		if len(cli.Teardown) > 0 {
+			fmt.Printf("%s  teardown:\n", indent)
+			printCommands(cli.Teardown, indent+"    ")
+		}
+		if steps, ok := config().Macros[strings.ToUpper(cli.Command)]; ok {
+			fmt.Printf("%s  steps:\n", indent)
+			printCommands(userMacroSteps(cli, steps), indent+"    ")
+		}
 	}
+}
 
-	if cli.Background {
-		return nil
+func resolveTemplate(cli CommandLine) (CommandLine, error) {
+	if cli.Template == "" {
+		return cli, nil
 	}
 
-	out, _ := ioutil.ReadAll(stdout)
-	errout, _ := ioutil.ReadAll(stderr)
+	tpl, ok := config().Templates[cli.Template]
+	if !ok {
+		return cli, fmt.Errorf("unknown template %s", cli.Template)
+	}
 
-	b := new(bytes.Buffer)
-	wr := transform.NewWriter(b, unicode.UTF8.NewDecoder())
-	wr.Write(out)
-	wr.Write(errout)
-	wr.Close()
-	bs := strings.TrimSpace(b.String())
-	if len(bs) > 0 {
-		fmt.Println(bs)
+	tpl = substituteParams(tpl, cli.Params)
+	if cli.Dir != "" {
+		tpl.Dir = cli.Dir
 	}
-	return nil
+	if len(cli.Env) > 0 {
+		env := make(map[string]string, len(tpl.Env)+len(cli.Env))
+		for k, v := range tpl.Env {
+			env[k] = v
+		}
+		for k, v := range cli.Env {
+			env[k] = v
+		}
+		tpl.Env = env
+	}
+	tpl.Template = ""
+	if cli.Name != "" {
+		tpl.Name = cli.Name
+	} else if tpl.Name == "" {
+		tpl.Name = cli.Template
+	}
+	tpl.IgnoreError = tpl.IgnoreError || cli.IgnoreError
+	tpl.Background = tpl.Background || cli.Background
+	tpl.NullStdout = tpl.NullStdout || cli.NullStdout
+	tpl.Confirm = tpl.Confirm || cli.Confirm
+	if cli.Timeout > 0 {
+		tpl.Timeout = cli.Timeout
+	}
+	if cli.Restart != "" {
+		tpl.Restart = cli.Restart
+	}
+	if cli.MaxRestarts > 0 {
+		tpl.MaxRestarts = cli.MaxRestarts
+	}
+	if cli.RestartWindow > 0 {
+		tpl.RestartWindow = cli.RestartWindow
+	}
+	if len(cli.DependsOn) > 0 {
+		tpl.DependsOn = cli.DependsOn
+	}
+	if cli.StopTimeout > 0 {
+		tpl.StopTimeout = cli.StopTimeout
+	}
+	if cli.Health != nil {
+		tpl.Health = cli.Health
+	}
+	if cli.Ready != nil {
+		tpl.Ready = cli.Ready
+	}
+	if len(cli.OnFailure) > 0 {
+		tpl.OnFailure = cli.OnFailure
+	}
+	if len(cli.Teardown) > 0 {
+		tpl.Teardown = cli.Teardown
+	}
+	return tpl, nil
 }
 
-func runMacro(cli CommandLine) error {
-	fmt.Printf("run macro: %s %s\n", cli.Command, strings.Join(cli.Args, " "))
-	switch strings.ToUpper(cli.Command) {
-	case "!WAIT_FILE":
-		return runMacroWaitFile(cli)
-	case "!WAIT_PORT":
-		return runMacroWaitPort(cli)
-	default:
-		return fmt.Errorf("unknown macro %s", cli.Command)
+func substituteParams(cli CommandLine, params map[string]string) CommandLine {
+	var pairs []string
+	for k, v := range params {
+		pairs = append(pairs, "{"+k+"}", v)
 	}
-}
+	r := strings.NewReplacer(pairs...)
 
-func runMacroWaitFile(cli CommandLine) error {
-	expire := time.Now().Add(cli.Timeout * time.Second).UnixMilli()
-	for {
-		ok := true
-		for _, name := range cli.Args {
-			_, err := os.Stat(name)
-			if err != nil {
-				ok = false
-				break
-			}
+	cli.Command = r.Replace(cli.Command)
+	args := make([]string, len(cli.Args))
+	for i, arg := range cli.Args {
+		args[i] = r.Replace(arg)
+	}
+	cli.Args = args
+	cli.Dir = r.Replace(cli.Dir)
+	if len(cli.Env) > 0 {
+		env := make(map[string]string, len(cli.Env))
+		for k, v := range cli.Env {
+			env[k] = r.Replace(v)
 		}
+		cli.Env = env
+	}
+	return cli
+}
 
-		if ok {
-			return nil
+// logStream logs each line of a command's stdout or stderr as it comes,
+// tagged [out] or [err].
+func logStream(cli CommandLine, stream string, r io.Reader, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	scanner := bufio.NewScanner(transform.NewReader(r, unicode.UTF8.NewDecoder()))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
 		}
+		logFor(cli).Info("[%s] %s", stream, line)
+		publishEvent(Event{Type: "output", Name: commandName(cli), Stream: stream, Text: line})
+	}
+	// a line too long for the scanner, keep the pipe flowing
+	io.Copy(ioutil.Discard, r)
+}
 
-		if time.Now().UnixMilli() >= expire {
-			break
+func isMacro(cli CommandLine) bool {
+	return strings.HasPrefix(cli.Command, "!")
+}
+
+func expandCommand(cli CommandLine) CommandLine {
+	cli.Command = os.ExpandEnv(cli.Command)
+	args := make([]string, len(cli.Args))
+	for i, arg := range cli.Args {
+		args[i] = os.ExpandEnv(arg)
+	}
+	cli.Args = args
+	cli.Dir = os.ExpandEnv(cli.Dir)
+	return cli
+}
+
+func isSecretName(name string) bool {
+	name = strings.ToUpper(name)
+	for _, word := range []string{"PASSWORD", "SECRET", "TOKEN"} {
+		if strings.Contains(name, word) {
+			return true
 		}
+	}
+	return false
+}
 
-		time.Sleep(time.Second / 2)
+// maskEnv hides the value of a K=V pair whose name looks like a secret.
+func maskEnv(kv string) string {
+	k := kv[:strings.Index(kv, "=")]
+	if isSecretName(k) {
+		return k + "=******"
 	}
+	return kv
+}
 
-	return errors.New("timeout")
+func commandEnv(cli CommandLine) []string {
+	var env []string
+	for k, v := range cli.Env {
+		env = append(env, k+"="+os.ExpandEnv(v))
+	}
+	sort.Strings(env)
+	return env
 }
 
-func runMacroWaitPort(cli CommandLine) error {
-	expire := time.Now().Add(cli.Timeout * time.Second).UnixMilli()
-	for {
-		ok := true
-		for _, port := range cli.Args {
-			conn, err := net.DialTimeout("tcp", port, time.Second/2)
+func askConfirm(question string) bool {
+	confirmMutex.Lock()
+	defer confirmMutex.Unlock()
+
+	fmt.Printf("%s [y/N] ", question)
+	var answer string
+	fmt.Scanln(&answer)
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func runCommand(ctx context.Context, cli CommandLine) error {
+	orig := cli
+	cli = expandCommand(cli)
+	if cli.Confirm && !askConfirm(fmt.Sprintf("confirm: %s %s ?", cli.Command, strings.Join(cli.Args, " "))) {
+		logFor(orig).Info("skip: %s", cli.Command)
+		return errSkipped
+	}
+
+	if isMacro(cli) {
+		return runMacro(ctx, cli)
+	}
+
+	logFor(orig).Info("run: %s %s", cli.Command, strings.Join(cli.Args, " "))
+	// background commands outlive the run
+	cmd := exec.Command(cli.Command, cli.Args...)
+	if !cli.Background {
+		cmd = exec.CommandContext(ctx, cli.Command, cli.Args...)
+	}
+	cmd.Dir = cli.Dir
+	if len(cli.Env) > 0 {
+		cmd.Env = append(os.Environ(), commandEnv(cli)...)
+	}
+	if logLevel <= levelDebug {
+		dir := cli.Dir
+		if dir == "" {
+			dir, _ = os.Getwd()
+		}
+		logFor(orig).Debug("path: %s", cmd.Path)
+		logFor(orig).Debug("cwd: %s", dir)
+		for _, kv := range commandEnv(cli) {
+			logFor(orig).Debug("env: %s", maskEnv(kv))
+		}
+	}
+
+	if cli.Background {
+		switch cli.Restart {
+		case "", "no", "on-failure", "always":
+		default:
+			return fmt.Errorf("bad restart policy %q, use no, on-failure or always", cli.Restart)
+		}
+		if h := cli.Health; h != nil && h.Port == "" && h.HTTP == "" && len(h.Command) == 0 {
+			return errors.New("health check needs a port, http or command")
+		}
+
+		if r := cli.Ready; r != nil && r.Port == "" && r.HTTP == "" && len(r.Command) == 0 && r.Log == "" {
+			return errors.New("ready check needs a port, http, command or log")
+		}
+		if cli.Ready != nil && cli.Ready.Log != "" && cli.NullStdout {
+			return errors.New("ready log needs the output, drop null_stdout")
+		}
+
+		var offset int64
+		if !cli.NullStdout {
+			f, err := openProcessLog(commandName(orig))
 			if err != nil {
-				ok = false
-				break
+				return err
 			}
-			if conn != nil {
-				conn.Close()
+			defer f.Close()
+			if fi, err := f.Stat(); err == nil {
+				offset = fi.Size()
 			}
+			cmd.Stdout = f
+			cmd.Stderr = f
 		}
 
-		if ok {
-			return nil
+		err := cmd.Start()
+		if err != nil {
+			return err
 		}
-
-		if time.Now().UnixMilli() >= expire {
-			break
+		addManagedCommand(orig, cmd)
+		if cli.Ready != nil {
+			return waitReady(ctx, orig, cmd.Process.Pid, offset)
 		}
+		return nil
+	}
 
-		time.Sleep(time.Second / 10)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
 	}
 
-	return errors.New("timeout")
+	// read both at once, a command filling one pipe while we wait on
+	// the other would hang
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	go logStream(orig, "out", stdout, &wg)
+	go logStream(orig, "err", stderr, &wg)
+	wg.Wait()
+	err = cmd.Wait()
+	if err != nil && ctx.Err() != nil {
+		return contextError(ctx)
+	}
+	return err
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+var (
+	metricsMutex    sync.Mutex
+	commandRuns     = make(map[string]uint64)
+	commandFailures = make(map[string]uint64)
+	commandDuration = make(map[string]*histogram)
+	processRestarts = make(map[string]uint64)
+	hotKeyTriggers  = make(map[string]uint64)
+
+	durationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300}
+)
+
+func observeCommand(name string, d time.Duration, err error) {
+	if err == errSkipped {
+		return
+	}
+
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+
+	commandRuns[name]++
+	if err != nil {
+		commandFailures[name]++
+	}
+
+	h := commandDuration[name]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		commandDuration[name] = h
+	}
+	secs := d.Seconds()
+	for i, le := range durationBuckets {
+		if secs <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += secs
+	h.count++
+}
+
+func countRestart(name string) {
+	metricsMutex.Lock()
+	processRestarts[name]++
+	metricsMutex.Unlock()
+}
+
+func countHotKey(name string) {
+	metricsMutex.Lock()
+	hotKeyTriggers[name]++
+	metricsMutex.Unlock()
+}
+
+func labelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeCounter(w io.Writer, name, help, label string, values map[string]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, k := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", name, label, labelValue(k), values[k])
+	}
+}
+
+// handleMetrics writes the Prometheus text exposition format.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+
+	writeCounter(w, "safework_commands_total", "Commands run.", "command", commandRuns)
+	writeCounter(w, "safework_command_failures_total", "Commands that failed.", "command", commandFailures)
+
+	name := "safework_command_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Command run time.\n# TYPE %s histogram\n", name, name)
+	keys := make([]string, 0, len(commandDuration))
+	for k := range commandDuration {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		h, label := commandDuration[k], labelValue(k)
+		for i, le := range durationBuckets {
+			fmt.Fprintf(w, "%s_bucket{command=\"%s\",le=\"%g\"} %d\n", name, label, le, h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{command=\"%s\",le=\"+Inf\"} %d\n", name, label, h.count)
+		fmt.Fprintf(w, "%s_sum{command=\"%s\"} %g\n", name, label, h.sum)
+		fmt.Fprintf(w, "%s_count{command=\"%s\"} %d\n", name, label, h.count)
+	}
+
+	writeCounter(w, "safework_process_restarts_total", "Background process restarts.", "process", processRestarts)
+	writeCounter(w, "safework_hotkey_triggers_total", "Hotkey presses.", "hotkey", hotKeyTriggers)
+
+	alive := 0
+	procs := managedProcesses()
+	for _, p := range procs {
+		if processAlive(p.Pid) {
+			alive++
+		}
+	}
+	fmt.Fprintf(w, "# HELP safework_managed_processes Managed background processes.\n# TYPE safework_managed_processes gauge\n")
+	fmt.Fprintf(w, "safework_managed_processes{state=\"alive\"} %d\n", alive)
+	fmt.Fprintf(w, "safework_managed_processes{state=\"dead\"} %d\n", len(procs)-alive)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type (
+	// MonitorConfig sets how often managed processes are sampled, in
+	// seconds (default 10), and the optional limits that raise a warning:
+	// CPU in percent of one core, Memory in MB and Handles as a count.
+	MonitorConfig struct {
+		Interval int     `json:"interval,omitempty"`
+		CPU      float64 `json:"cpu,omitempty"`
+		Memory   uint64  `json:"memory,omitempty"`
+		Handles  int     `json:"handles,omitempty"`
+	}
+
+	resourceUsage struct {
+		CPUTime time.Duration
+		Memory  uint64
+		Handles int
+	}
+
+	usageSample struct {
+		resourceUsage
+		at time.Time
+	}
+)
+
+func startMonitor() {
+	interval := 10 * time.Second
+	if cfg := config().Monitor; cfg != nil && cfg.Interval > 0 {
+		interval = time.Duration(cfg.Interval) * time.Second
+	}
+
+	go func() {
+		last := make(map[int]usageSample)
+		warned := make(map[string]bool)
+		for range time.Tick(interval) {
+			next := make(map[int]usageSample)
+			for _, p := range managedProcesses() {
+				u, err := processUsage(p.Pid)
+				if err != nil {
+					continue
+				}
+				now := usageSample{u, time.Now()}
+				next[p.Pid] = now
+
+				cpu := 0.0
+				if prev, ok := last[p.Pid]; ok && now.at.After(prev.at) {
+					cpu = float64(now.CPUTime-prev.CPUTime) / float64(now.at.Sub(prev.at)) * 100
+				}
+				setProcessUsage(p.Pid, cpu, u)
+				checkLimits(p.Name, p.Pid, cpu, u, warned)
+			}
+			last = next
+		}
+	}()
+}
+
+func setProcessUsage(pid int, cpu float64, u resourceUsage) {
+	managedMutex.Lock()
+	defer managedMutex.Unlock()
+
+	for _, p := range managedProcs {
+		if p.Pid == pid {
+			p.CPU, p.Memory, p.Handles = cpu, u.Memory, u.Handles
+		}
+	}
+}
+
+// checkLimits warns once when a process goes over a limit, and again only
+// after it has come back under.
+func checkLimits(name string, pid int, cpu float64, u resourceUsage, warned map[string]bool) {
+	cfg := config().Monitor
+	if cfg == nil {
+		return
+	}
+
+	check := func(what string, over bool, text string) {
+		key := fmt.Sprintf("%d %s", pid, what)
+		if !over {
+			delete(warned, key)
+			return
+		}
+		if warned[key] {
+			return
+		}
+		warned[key] = true
+		logWarn("[WARNING] %s (pid %d): %s", name, pid, text)
+		publishEvent(Event{Type: "warning", Name: name, Text: text})
+		sendNotification("safework: "+name+" "+what, text)
+	}
+
+	if cfg.CPU > 0 {
+		check("cpu", cpu > cfg.CPU, fmt.Sprintf("cpu %.0f%% over %.0f%%", cpu, cfg.CPU))
+	}
+	if cfg.Memory > 0 {
+		check("memory", u.Memory > cfg.Memory<<20, fmt.Sprintf("memory %s over %d MB", formatBytes(u.Memory), cfg.Memory))
+	}
+	if cfg.Handles > 0 {
+		check("handles", u.Handles > cfg.Handles, fmt.Sprintf("%d handles over %d", u.Handles, cfg.Handles))
+	}
+}
+
+func formatBytes(n uint64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.0f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+func mountShare(share, target, user, password string) error {
+	share = strings.TrimLeft(strings.ReplaceAll(share, `\`, "/"), "/")
+	if user != "" {
+		share = url.PathEscape(user) + "@" + share
+	}
+
+	err := os.MkdirAll(target, 0755)
+	if err != nil {
+		return err
+	}
+
+	if password == "" {
+		// the keychain or a guest login, never a prompt
+		return runQuiet(exec.Command("mount_smbfs", "-N", "//"+share, target))
+	}
+	cmd := exec.Command("mount_smbfs", "//"+share, target)
+	// mount_smbfs asks for the password with getpass(3), which reads stdin
+	// when there is no terminal, so a new session keeps the password out
+	// of the URL and the process list
+	cmd.Stdin = strings.NewReader(password + "\n")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	return runQuiet(cmd)
+}
+
+func unmountShare(target string) error {
+	return runQuiet(exec.Command("umount", target))
+}
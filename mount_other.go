@@ -0,0 +1,30 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func mountShare(share, target, user, password string) error {
+	share = "//" + strings.TrimLeft(strings.ReplaceAll(share, `\`, "/"), "/")
+
+	err := os.MkdirAll(target, 0755)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("mount", "-t", "cifs", share, target)
+	if user != "" {
+		cmd.Args = append(cmd.Args, "-o", "username="+user)
+	}
+	// mount.cifs reads the password from $PASSWD, which keeps it off the command line
+	cmd.Env = append(os.Environ(), "PASSWD="+password)
+	return runQuiet(cmd)
+}
+
+func unmountShare(target string) error {
+	return runQuiet(exec.Command("umount", target))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const resourceTypeDisk = 1
+
+// netResource is NETRESOURCEW.
+type netResource struct {
+	Scope       uint32
+	Type        uint32
+	DisplayType uint32
+	Usage       uint32
+	LocalName   *uint16
+	RemoteName  *uint16
+	Comment     *uint16
+	Provider    *uint16
+}
+
+var (
+	mpr                     = syscall.NewLazyDLL("mpr.dll")
+	procWNetAddConnection2W = mpr.NewProc("WNetAddConnection2W")
+)
+
+// mountShare maps the share with WNetAddConnection2 rather than net use,
+// which would need the password on its command line, visible to every
+// local user.
+func mountShare(share, target, user, password string) error {
+	share = strings.ReplaceAll(share, "/", `\`)
+	local, err := syscall.UTF16PtrFromString(target)
+	if err != nil {
+		return err
+	}
+	remote, err := syscall.UTF16PtrFromString(share)
+	if err != nil {
+		return err
+	}
+
+	// nil uses the credentials of the current user
+	var pass, name *uint16
+	if password != "" {
+		pass, err = syscall.UTF16PtrFromString(password)
+		if err != nil {
+			return err
+		}
+	}
+	if user != "" {
+		name, err = syscall.UTF16PtrFromString(user)
+		if err != nil {
+			return err
+		}
+	}
+
+	nr := netResource{Type: resourceTypeDisk, LocalName: local, RemoteName: remote}
+	// no CONNECT_UPDATE_PROFILE, so the mapping doesn't persist
+	r, _, _ := procWNetAddConnection2W.Call(uintptr(unsafe.Pointer(&nr)), uintptr(unsafe.Pointer(pass)), uintptr(unsafe.Pointer(name)), 0)
+	if r != 0 {
+		return syscall.Errno(r)
+	}
+	return nil
+}
+
+func unmountShare(target string) error {
+	return runQuiet(exec.Command("net", "use", target, "/delete", "/y"))
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MQTTConfig connects safework to a broker. Under Topic it subscribes to
+// <topic>/trigger (payload: hotkey actions, comma separated) and <topic>/run
+// (payload: a task name, or startup), and publishes <topic>/status,
+// <topic>/events and <topic>/report.
+type MQTTConfig struct {
+	Broker   string `json:"broker"`
+	ClientID string `json:"client_id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Topic    string `json:"topic,omitempty"`
+}
+
+type mqttClient struct {
+	conn net.Conn
+	mu   sync.Mutex
+}
+
+const (
+	mqttConnect   = 0x10
+	mqttConnAck   = 0x20
+	mqttPublish   = 0x30
+	mqttSubscribe = 0x82
+	mqttPingReq   = 0xC0
+	mqttKeepAlive = 60
+
+	// pings go out every half keepalive, so a broker silent for longer
+	// than this is gone even if the connection looks open
+	mqttReadTimeout = mqttKeepAlive * 3 / 2 * time.Second
+)
+
+func startMQTT() error {
+	if config().MQTT == nil {
+		return nil
+	}
+	// a copy, the defaults below are not written into the shared config
+	cfg := *config().MQTT
+	if cfg.Topic == "" {
+		cfg.Topic = "safework"
+	}
+	if cfg.ClientID == "" {
+		host, _ := os.Hostname()
+		cfg.ClientID = "safework-" + host
+	}
+	_, err := url.Parse(cfg.Broker)
+	if err != nil {
+		logError("ERR: mqtt: %s", err)
+		return err
+	}
+
+	go func() {
+		for {
+			err := runMQTT(&cfg)
+			logError("---> mqtt: %s, reconnect in 10s", err)
+			time.Sleep(10 * time.Second)
+		}
+	}()
+	return nil
+}
+
+func dialMQTT(broker string) (net.Conn, error) {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "1883")
+		}
+		return net.DialTimeout("tcp", host, 10*time.Second)
+	case "ssl", "tls", "mqtts":
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "8883")
+		}
+		return tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("unsupported broker scheme %q, use tcp:// or ssl://", u.Scheme)
+	}
+}
+
+func runMQTT(cfg *MQTTConfig) error {
+	conn, err := dialMQTT(cfg.Broker)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	c := &mqttClient{conn: conn}
+	r := bufio.NewReader(conn)
+
+	err = c.connect(cfg)
+	if err != nil {
+		return err
+	}
+	conn.SetReadDeadline(time.Now().Add(mqttReadTimeout))
+	typ, body, err := readMQTTPacket(r)
+	if err != nil {
+		return err
+	}
+	if typ != mqttConnAck || len(body) < 2 {
+		return errors.New("no CONNACK from broker")
+	}
+	if body[1] != 0 {
+		return fmt.Errorf("broker refused connection, code %d", body[1])
+	}
+
+	err = c.subscribe(cfg.Topic+"/trigger", cfg.Topic+"/run")
+	if err != nil {
+		return err
+	}
+	c.publish(cfg.Topic+"/status", []byte("online"), true)
+	logInfo("mqtt: connected to %s", cfg.Broker)
+
+	events, cancel := subscribeEvents()
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ping := time.NewTicker(mqttKeepAlive / 2 * time.Second)
+		defer ping.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ping.C:
+				c.write([]byte{mqttPingReq, 0})
+			case e := <-events:
+				if e.Type == "log" {
+					continue
+				}
+				b, _ := json.Marshal(e)
+				c.publish(cfg.Topic+"/events", b, false)
+			}
+		}
+	}()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(mqttReadTimeout))
+		typ, body, err := readMQTTPacket(r)
+		if err != nil {
+			return err
+		}
+		if typ&0xF0 != mqttPublish {
+			continue
+		}
+
+		topic, payload, err := parseMQTTPublish(typ, body)
+		if err != nil {
+			return err
+		}
+		go handleMQTTMessage(c, cfg, topic, strings.TrimSpace(string(payload)))
+	}
+}
+
+func handleMQTTMessage(c *mqttClient, cfg *MQTTConfig, topic, payload string) {
+	switch topic {
+	case cfg.Topic + "/trigger":
+		err := triggerActions("mqtt", strings.Split(payload, ","))
+		if err != nil {
+			logError("---> mqtt: %s", err)
+		}
+
+	case cfg.Topic + "/run":
+		var report *RunReport
+		var err error
+		if payload == "startup" {
+			report, err = runStartup()
+		} else {
+			report, err = runTask(payload)
+		}
+		if report == nil {
+			logError("---> mqtt: %s", err)
+			return
+		}
+		b, _ := json.Marshal(report.status())
+		c.publish(cfg.Topic+"/report", b, true)
+	}
+}
+
+func (c *mqttClient) write(b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := c.conn.Write(b)
+	return err
+}
+
+func (c *mqttClient) connect(cfg *MQTTConfig) error {
+	flags := byte(0x02 | 0x04 | 0x20) // clean session, retained will
+	var payload []byte
+	payload = appendMQTTString(payload, cfg.ClientID)
+	payload = appendMQTTString(payload, cfg.Topic+"/status")
+	payload = appendMQTTString(payload, "offline")
+	if cfg.Username != "" {
+		flags |= 0x80
+		payload = appendMQTTString(payload, os.ExpandEnv(cfg.Username))
+	}
+	if cfg.Password != "" {
+		flags |= 0x40
+		payload = appendMQTTString(payload, os.ExpandEnv(cfg.Password))
+	}
+
+	body := appendMQTTString(nil, "MQTT")
+	body = append(body, 4, flags, 0, mqttKeepAlive)
+	return c.write(mqttPacket(mqttConnect, append(body, payload...)))
+}
+
+func (c *mqttClient) subscribe(topics ...string) error {
+	body := []byte{0, 1}
+	for _, topic := range topics {
+		body = appendMQTTString(body, topic)
+		body = append(body, 0)
+	}
+	return c.write(mqttPacket(mqttSubscribe, body))
+}
+
+func (c *mqttClient) publish(topic string, payload []byte, retain bool) error {
+	typ := byte(mqttPublish)
+	if retain {
+		typ |= 0x01
+	}
+	return c.write(mqttPacket(typ, append(appendMQTTString(nil, topic), payload...)))
+}
+
+func appendMQTTString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
+
+func mqttPacket(typ byte, body []byte) []byte {
+	b := []byte{typ}
+	n := len(body)
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			break
+		}
+	}
+	return append(b, body...)
+}
+
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	n, shift := 0, 0
+	for {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= int(digit&0x7F) << shift
+		if digit&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return 0, nil, errors.New("malformed packet length")
+		}
+	}
+
+	body := make([]byte, n)
+	_, err = io.ReadFull(r, body)
+	return typ, body, err
+}
+
+func parseMQTTPublish(typ byte, body []byte) (string, []byte, error) {
+	if len(body) < 2 {
+		return "", nil, errors.New("malformed PUBLISH")
+	}
+	n := int(body[0])<<8 | int(body[1])
+	if len(body) < 2+n {
+		return "", nil, errors.New("malformed PUBLISH")
+	}
+	topic, rest := string(body[2:2+n]), body[2+n:]
+	if typ&0x06 != 0 {
+		// QoS 1 and 2 carry a packet id
+		if len(rest) < 2 {
+			return "", nil, errors.New("malformed PUBLISH")
+		}
+		rest = rest[2:]
+	}
+	return topic, rest, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strings"
+)
+
+func pingHost(host string) bool {
+	return exec.Command("ping", "-c", "1", "-t", "1", host).Run() == nil
+}
+
+func currentSSID() string {
+	for _, dev := range []string{"en0", "en1"} {
+		out, err := exec.Command("networksetup", "-getairportnetwork", dev).Output()
+		if err != nil {
+			continue
+		}
+		_, ssid, ok := strings.Cut(strings.TrimSpace(string(out)), "Current Wi-Fi Network: ")
+		if ok {
+			return ssid
+		}
+	}
+	return ""
+}
+
+func defaultGateway() string {
+	out, err := exec.Command("route", "-n", "get", "default").Output()
+	if err != nil {
+		return ""
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		k, v, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.TrimSpace(k) == "gateway" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
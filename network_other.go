@@ -0,0 +1,59 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func pingHost(host string) bool {
+	return exec.Command("ping", "-c", "1", "-W", "1", host).Run() == nil
+}
+
+func currentSSID() string {
+	out, err := exec.Command("iwgetid", "-r").Output()
+	if err == nil {
+		return strings.TrimSpace(string(out))
+	}
+
+	out, err = exec.Command("nmcli", "-t", "-f", "active,ssid", "dev", "wifi").Output()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "yes:") {
+			return strings.TrimPrefix(line, "yes:")
+		}
+	}
+	return ""
+}
+
+func defaultGateway() string {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		b, err := hex.DecodeString(fields[2])
+		if err != nil || len(b) != 4 {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(b))
+		return ip.String()
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strings"
+)
+
+func pingHost(host string) bool {
+	return exec.Command("ping", "-n", "1", "-w", "1000", host).Run() == nil
+}
+
+func currentSSID() string {
+	out, err := exec.Command("netsh", "wlan", "show", "interfaces").Output()
+	if err != nil {
+		return ""
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		k, v, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.TrimSpace(k) == "SSID" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+func defaultGateway() string {
+	out, err := exec.Command("route", "print", "-4", "0.0.0.0").Output()
+	if err != nil {
+		return ""
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 3 && fields[0] == "0.0.0.0" && fields[1] == "0.0.0.0" {
+			return fields[2]
+		}
+	}
+	return ""
+}
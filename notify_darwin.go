@@ -0,0 +1,11 @@
+package main
+
+import "os/exec"
+
+func notify(title, message string) error {
+	return exec.Command("osascript",
+		"-e", "on run argv",
+		"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+		"-e", "end run",
+		title, message).Run()
+}
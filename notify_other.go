@@ -0,0 +1,9 @@
+//go:build !windows && !darwin
+
+package main
+
+import "os/exec"
+
+func notify(title, message string) error {
+	return exec.Command("notify-send", "--app-name=safework", title, message).Run()
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+const toastScript = `
+[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+$t = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$n = $t.GetElementsByTagName('text')
+$n.Item(0).AppendChild($t.CreateTextNode($env:SAFEWORK_NOTIFY_TITLE)) | Out-Null
+$n.Item(1).AppendChild($t.CreateTextNode($env:SAFEWORK_NOTIFY_MESSAGE)) | Out-Null
+$toast = [Windows.UI.Notifications.ToastNotification]::new($t)
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe').Show($toast)
+`
+
+func notify(title, message string) error {
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", toastScript)
+	cmd.Env = append(os.Environ(), "SAFEWORK_NOTIFY_TITLE="+title, "SAFEWORK_NOTIFY_MESSAGE="+message)
+	return cmd.Run()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// runOnce runs a task, "startup" or "cleanup" in this process and
+// returns the exit code, without hotkeys or servers. It is what `safework
+// run` does when no instance is running, for scripts and CI.
+func runOnce(name, dir string) int {
+	err := loadConfig(dir)
+	if err != nil {
+		fmt.Println(err)
+		return exitConfig
+	}
+	err = setupLogging(config().Log)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return exitConfig
+	}
+	if path := configuredLogFile(); path != "" {
+		err = openLogFile(path)
+		if err != nil {
+			fmt.Printf("ERR: %s\n", err)
+			return exitConfig
+		}
+	}
+
+	defer pendingPosts.Wait()
+
+	// a signal stops the run, cleanup is left to the caller
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(c)
+	go func() {
+		for sig := range c {
+			logWarn("[SIGNAL %s]", sig)
+			cancelRun()
+		}
+	}()
+
+	switch name {
+	case "startup":
+		report, err := runStartup()
+		if err != nil {
+			rollback(report)
+			return exitStartup
+		}
+	case "cleanup":
+		if cleanup() != nil {
+			return exitCleanup
+		}
+	default:
+		if _, ok := config().Tasks[name]; !ok {
+			fmt.Printf("ERR: unknown task %s\n", name)
+			return exitConfig
+		}
+		_, err := runTask(name)
+		if err != nil {
+			return exitError
+		}
+	}
+	return exitOK
+}
@@ -0,0 +1,10 @@
+package main
+
+import "os/exec"
+
+func openURL(browser, url string) error {
+	if browser != "" {
+		return exec.Command("open", "-a", browser, url).Start()
+	}
+	return exec.Command("open", url).Start()
+}
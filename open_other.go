@@ -0,0 +1,12 @@
+//go:build !windows && !darwin
+
+package main
+
+import "os/exec"
+
+func openURL(browser, url string) error {
+	if browser != "" {
+		return exec.Command(browser, url).Start()
+	}
+	return exec.Command("xdg-open", url).Start()
+}
@@ -0,0 +1,10 @@
+package main
+
+import "os/exec"
+
+func openURL(browser, url string) error {
+	if browser != "" {
+		return exec.Command(browser, url).Start()
+	}
+	return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+}
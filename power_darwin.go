@@ -0,0 +1,15 @@
+package main
+
+import (
+	"bytes"
+	"os/exec"
+)
+
+// onACPower reports whether pmset says power comes from the adapter.
+func onACPower() (bool, error) {
+	out, err := exec.Command("pmset", "-g", "batt").Output()
+	if err != nil {
+		return false, err
+	}
+	return bytes.Contains(out, []byte("'AC Power'")), nil
+}
@@ -0,0 +1,35 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// onACPower reports whether a mains supply is online.
+func onACPower() (bool, error) {
+	supplies, _ := filepath.Glob("/sys/class/power_supply/*")
+	found := false
+	for _, dir := range supplies {
+		kind, err := ioutil.ReadFile(filepath.Join(dir, "type"))
+		if err != nil || strings.TrimSpace(string(kind)) != "Mains" {
+			continue
+		}
+		online, err := ioutil.ReadFile(filepath.Join(dir, "online"))
+		if err != nil {
+			continue
+		}
+		if strings.TrimSpace(string(online)) == "1" {
+			return true, nil
+		}
+		found = true
+	}
+
+	if !found {
+		return false, errors.New("no mains power supply found")
+	}
+	return false, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"unsafe"
+)
+
+var procGetSystemPowerStatus = kernel32.NewProc("GetSystemPowerStatus")
+
+type systemPowerStatus struct {
+	ACLineStatus        byte
+	BatteryFlag         byte
+	BatteryLifePercent  byte
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+func onACPower() (bool, error) {
+	var status systemPowerStatus
+	ret, _, err := procGetSystemPowerStatus.Call(uintptr(unsafe.Pointer(&status)))
+	if ret == 0 {
+		return false, err
+	}
+	if status.ACLineStatus == 255 {
+		return false, errors.New("unknown power line status")
+	}
+	return status.ACLineStatus == 1, nil
+}
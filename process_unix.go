@@ -0,0 +1,57 @@
+//go:build !windows
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+func findProcesses(name string) ([]int, error) {
+	out, err := exec.Command("ps", "-axo", "pid=,comm=").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.SplitN(strings.TrimSpace(scanner.Text()), " ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		if filepath.Base(strings.TrimSpace(fields[1])) != name {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+func killProcess(pid int, force bool) error {
+	// never signal a process group or everything we may
+	if pid <= 0 {
+		return fmt.Errorf("invalid pid %d", pid)
+	}
+	if force {
+		return syscall.Kill(pid, syscall.SIGKILL)
+	}
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
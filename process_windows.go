@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	processTerminate               = 0x0001
+	processQueryLimitedInformation = 0x1000
+	stillActive                    = 259
+)
+
+func processNames() map[uint32]string {
+	names := make(map[uint32]string)
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return names
+	}
+	defer syscall.CloseHandle(snapshot)
+
+	var entry syscall.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	err = syscall.Process32First(snapshot, &entry)
+	for err == nil {
+		names[entry.ProcessID] = syscall.UTF16ToString(entry.ExeFile[:])
+		err = syscall.Process32Next(snapshot, &entry)
+	}
+	return names
+}
+
+func findProcesses(name string) ([]int, error) {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".exe") {
+		name += ".exe"
+	}
+
+	var pids []int
+	for pid, exe := range processNames() {
+		if strings.ToLower(exe) == name {
+			pids = append(pids, int(pid))
+		}
+	}
+	return pids, nil
+}
+
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+
+	var code uint32
+	err = syscall.GetExitCodeProcess(h, &code)
+	return err == nil && code == stillActive
+}
+
+func killProcess(pid int, force bool) error {
+	if !force {
+		// taskkill without /F asks the windows to close, like clicking X
+		return exec.Command("taskkill", "/PID", strconv.Itoa(pid)).Run()
+	}
+
+	h, err := syscall.OpenProcess(processTerminate, false, uint32(pid))
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(h)
+	return syscall.TerminateProcess(h, 1)
+}
@@ -0,0 +1,33 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// processStartID identifies a process across pid reuse by its start time,
+// in clock ticks since boot. It is empty when the process is gone.
+func processStartID(pid int) string {
+	b, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return ""
+	}
+	// the command name may hold spaces, starttime is field 22
+	s := string(b)
+	fields := strings.Fields(s[strings.LastIndex(s, ")")+1:])
+	if len(fields) < 20 {
+		return ""
+	}
+	return fields[19]
+}
+
+func bootID() string {
+	b, err := ioutil.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
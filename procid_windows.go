@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strconv"
+	"syscall"
+)
+
+// processStartID identifies a process across pid reuse by its creation
+// time. It is empty when the process is gone.
+func processStartID(pid int) string {
+	h, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return ""
+	}
+	defer syscall.CloseHandle(h)
+
+	var created, exited, kernel, user syscall.Filetime
+	err = syscall.GetProcessTimes(h, &created, &exited, &kernel, &user)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatInt(created.Nanoseconds(), 10)
+}
+
+// bootID is unknown on Windows, the creation time is precise enough that
+// a process after a reboot won't match it.
+func bootID() string {
+	return ""
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogsConfig sets where background process output goes. MaxSize is in MB
+// (default 10) and Keep is the number of rotated files (default 3).
+type LogsConfig struct {
+	Dir     string `json:"dir,omitempty"`
+	MaxSize int    `json:"max_size,omitempty"`
+	Keep    int    `json:"keep,omitempty"`
+}
+
+var rotateOnce sync.Once
+
+func processLogsDir() string {
+	if config() != nil && config().Logs != nil && config().Logs.Dir != "" {
+		dir := os.ExpandEnv(config().Logs.Dir)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(configDir, dir)
+		}
+		return dir
+	}
+	return filepath.Join(configDir, "logs")
+}
+
+func processLogPath(name string) string {
+	clean := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, filepath.Base(name))
+	return filepath.Join(processLogsDir(), clean+".log")
+}
+
+func logLimits() (int64, int) {
+	size, keep := int64(10), 3
+	if cfg := config().Logs; cfg != nil {
+		if cfg.MaxSize > 0 {
+			size = int64(cfg.MaxSize)
+		}
+		if cfg.Keep > 0 {
+			keep = cfg.Keep
+		}
+	}
+	return size << 20, keep
+}
+
+// openProcessLog opens the log a background process writes to. The child
+// gets the file itself rather than a pipe, so it keeps running and
+// logging if safework dies, and the log is rotated by copy and truncate.
+func openProcessLog(name string) (*os.File, error) {
+	path := processLogPath(name)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	rotateLog(path)
+	rotateOnce.Do(func() {
+		go func() {
+			for range time.Tick(10 * time.Second) {
+				files, _ := filepath.Glob(filepath.Join(processLogsDir(), "*.log"))
+				for _, path := range files {
+					rotateLog(path)
+				}
+			}
+		}()
+	})
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+}
+
+// rotateLog moves path to path.1 when it is over the size limit.
+func rotateLog(path string) {
+	size, keep := logLimits()
+	fi, err := os.Stat(path)
+	if err != nil || fi.Size() < size {
+		return
+	}
+
+	shiftLogs(path, keep)
+	err = copyFile(path, path+".1", 0644)
+	if err == nil {
+		err = os.Truncate(path, 0)
+	}
+	if err != nil {
+		logError("ERR: rotate %s, %s", path, err)
+	}
+}
+
+// shiftLogs moves path.1 .. path.keep-1 up by one, dropping path.keep.
+func shiftLogs(path string, keep int) {
+	os.Remove(fmt.Sprintf("%s.%d", path, keep))
+	for i := keep - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+	}
+}
+
+// runLogsCommand handles `safework logs [-f] [-n lines] <name> [config dir]`.
+func runLogsCommand(args []string) int {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	follow := fs.Bool("f", false, "keep printing lines as they are written")
+	lines := fs.Int("n", 20, "number of lines to print")
+	if fs.Parse(args) != nil {
+		return 2
+	}
+	// allow flags after the name too
+	rest := fs.Args()
+	if len(rest) > 0 {
+		fs.Parse(rest[1:])
+		rest = append(rest[:1], fs.Args()...)
+	}
+	if len(rest) < 1 || len(rest) > 2 {
+		fmt.Println("usage: safework logs [-f] [-n lines] <name> [config dir]")
+		return 2
+	}
+
+	dir := ""
+	if len(rest) > 1 {
+		dir = rest[1]
+	}
+	err := loadConfig(dir)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+
+	path := processLogPath(rest[0])
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	offset, err := printTail(f, *lines)
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+	if !*follow {
+		return 0
+	}
+
+	for range time.Tick(500 * time.Millisecond) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if fi.Size() < offset {
+			// rotated
+			offset = 0
+		}
+		if fi.Size() == offset {
+			continue
+		}
+
+		f.Seek(offset, io.SeekStart)
+		n, _ := io.Copy(os.Stdout, f)
+		offset += n
+	}
+	return 0
+}
+
+// printTail prints the last n lines of f and returns the end offset.
+func printTail(f *os.File, n int) (int64, error) {
+	var tail []string
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, err := r.ReadString('\n')
+		offset += int64(len(line))
+		if line != "" {
+			tail = append(tail, line)
+			if len(tail) > n {
+				tail = tail[1:]
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for _, line := range tail {
+		fmt.Print(line)
+	}
+	return offset, nil
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+type ManagedProcess struct {
+	Name     string    `json:"name"`
+	Pid      int       `json:"pid"`
+	Started  time.Time `json:"started"`
+	Restarts int       `json:"restarts"`
+
+	// sampled by the monitor
+	CPU     float64 `json:"cpu"`
+	Memory  uint64  `json:"memory"`
+	Handles int     `json:"handles"`
+
+	// cli is set for background commands, which can be restarted.
+	cli *CommandLine
+
+	// identity is the processStartID of Pid, so a reused pid is not
+	// mistaken for it
+	identity string
+}
+
+var (
+	managedMutex sync.Mutex
+	managedProcs []*ManagedProcess
+
+	// restartCounts carries restarts over to the new process, by name,
+	// until cleanup
+	restartCounts = make(map[string]int)
+	restartTimes  = make(map[string][]time.Time)
+
+	// stopDeadline, when set, cuts stop timeouts short so cleanup fits in
+	// the time the OS gives before killing safework
+	stopDeadline time.Time
+)
+
+func addManagedProcess(name string, pid int) {
+	managedMutex.Lock()
+	defer managedMutex.Unlock()
+
+	for _, p := range managedProcs {
+		if p.Pid == pid {
+			return
+		}
+	}
+	managedProcs = append(managedProcs, &ManagedProcess{Name: name, Pid: pid, Started: time.Now(), identity: processStartID(pid)})
+	saveState()
+}
+
+// addManagedCommand records a started background command and reaps it
+// when it exits, so that processAlive sees the exit.
+func addManagedCommand(cli CommandLine, cmd *exec.Cmd) {
+	managedMutex.Lock()
+	managedProcs = append(managedProcs, &ManagedProcess{
+		Name:     commandName(cli),
+		Pid:      cmd.Process.Pid,
+		Started:  time.Now(),
+		Restarts: restartCounts[commandName(cli)],
+		cli:      &cli,
+		identity: processStartID(cmd.Process.Pid),
+	})
+	saveState()
+	managedMutex.Unlock()
+
+	if cli.Health != nil {
+		go watchHealth(cli, cmd.Process.Pid)
+	}
+	go func() {
+		err := cmd.Wait()
+		if !isManaged(cmd.Process.Pid) {
+			return
+		}
+
+		// still listed, so it was not stopped by cleanup or a restart
+		superviseExit(cli, cmd.Process.Pid, err)
+	}()
+}
+
+func isManaged(pid int) bool {
+	managedMutex.Lock()
+	defer managedMutex.Unlock()
+
+	for _, p := range managedProcs {
+		if p.Pid == pid {
+			return true
+		}
+	}
+	return false
+}
+
+func managedProcesses() []ManagedProcess {
+	managedMutex.Lock()
+	defer managedMutex.Unlock()
+
+	procs := make([]ManagedProcess, len(managedProcs))
+	for i, p := range managedProcs {
+		procs[i] = *p
+	}
+	return procs
+}
+
+func stopManagedProcesses() {
+	managedMutex.Lock()
+	procs := managedProcs
+	managedProcs = nil
+	restartCounts = make(map[string]int)
+	restartTimes = make(map[string][]time.Time)
+	managedMutex.Unlock()
+
+	for _, p := range stopOrder(procs) {
+		stopProcess(p)
+	}
+
+	// keep the state until everything is stopped
+	managedMutex.Lock()
+	saveState()
+	managedMutex.Unlock()
+}
+
+// stopOrder is the reverse of the start order, moved around so that a
+// process stops before anything it depends on.
+func stopOrder(procs []*ManagedProcess) []*ManagedProcess {
+	var order []*ManagedProcess
+	left := make([]*ManagedProcess, len(procs))
+	for i, p := range procs {
+		left[len(procs)-1-i] = p
+	}
+
+	for len(left) > 0 {
+		next := 0
+		for i, p := range left {
+			if !hasDependents(p, left) {
+				next = i
+				break
+			}
+		}
+		// with a cycle nothing is free, so the newest goes first
+		order = append(order, left[next])
+		left = append(left[:next], left[next+1:]...)
+	}
+	return order
+}
+
+func hasDependents(p *ManagedProcess, procs []*ManagedProcess) bool {
+	for _, other := range procs {
+		if other == p || other.cli == nil {
+			continue
+		}
+		for _, name := range other.cli.DependsOn {
+			if name == p.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// alive reports whether the process is still running, and not another
+// one that got its pid.
+func (p *ManagedProcess) alive() bool {
+	if !processAlive(p.Pid) {
+		return false
+	}
+	return p.identity == "" || processStartID(p.Pid) == p.identity
+}
+
+func stopProcess(p *ManagedProcess) {
+	if !p.alive() {
+		return
+	}
+
+	cmdLogger(p.Name).Info("stop: %s (pid %d)", p.Name, p.Pid)
+	killProcess(p.Pid, false)
+
+	timeout := 5 * time.Second
+	if p.cli != nil && p.cli.StopTimeout > 0 {
+		timeout = p.cli.StopTimeout * time.Second
+	}
+	expire := time.Now().Add(timeout)
+	if !stopDeadline.IsZero() && stopDeadline.Before(expire) {
+		expire = stopDeadline
+	}
+	for p.alive() && time.Now().Before(expire) {
+		time.Sleep(time.Second / 10)
+	}
+	if p.alive() {
+		cmdLogger(p.Name).Warn("force stop: %s (pid %d)", p.Name, p.Pid)
+		killProcess(p.Pid, true)
+	}
+}
+
+// restartManagedProcess stops a background command and runs it again.
+func restartManagedProcess(pid int) error {
+	name, err := respawnProcess(pid)
+	if err != nil {
+		if name != "" {
+			sendNotification("safework: "+name+" restart failed", err.Error())
+		}
+		return err
+	}
+	sendNotification("safework: "+name+" restarted", "background process started again")
+	return nil
+}
+
+func respawnProcess(pid int) (string, error) {
+	managedMutex.Lock()
+	var p *ManagedProcess
+	for i, mp := range managedProcs {
+		if mp.Pid == pid {
+			p = mp
+			if mp.cli != nil {
+				managedProcs = append(managedProcs[:i], managedProcs[i+1:]...)
+				restartCounts[mp.Name]++
+				saveState()
+			}
+			break
+		}
+	}
+	managedMutex.Unlock()
+
+	if p == nil {
+		return "", fmt.Errorf("pid %d is not managed", pid)
+	}
+	if p.cli == nil {
+		return "", fmt.Errorf("%s was not started by safework", p.Name)
+	}
+
+	logSection("[RESTART %s]", p.Name)
+	countRestart(p.Name)
+	stopProcess(p)
+	return p.Name, runCommand(context.Background(), *p.cli)
+}
+
+// superviseExit applies the restart policy of a background command that
+// ended on its own.
+func superviseExit(cli CommandLine, pid int, err error) {
+	name := commandName(cli)
+	restart := cli.Restart == "always" || (cli.Restart == "on-failure" && err != nil)
+	if !restart {
+		if err != nil {
+			cmdLogger(name).Warn("[CRASHED] %s (pid %d): %s", name, pid, err)
+			sendNotification("safework: "+name+" crashed", err.Error())
+		} else {
+			cmdLogger(name).Warn("[EXITED] %s (pid %d)", name, pid)
+			sendNotification("safework: "+name+" exited", "background process ended")
+		}
+		return
+	}
+
+	reason := "exit status 0"
+	if err != nil {
+		reason = err.Error()
+	}
+	if !allowRestart(cli) {
+		window := restartWindow(cli)
+		cmdLogger(name).Warn("[GAVE UP] %s (pid %d): %s, %d restarts within %s", name, pid, reason, cli.MaxRestarts, window)
+		sendNotification("safework: "+name+" keeps failing", fmt.Sprintf("%d restarts within %s, giving up", cli.MaxRestarts, window))
+		sendAlert("gave_up", "safework: "+name+" keeps failing", fmt.Sprintf("%s, %d restarts within %s, giving up", reason, cli.MaxRestarts, window))
+		return
+	}
+
+	cmdLogger(name).Warn("[EXITED] %s (pid %d): %s, restarting", name, pid, reason)
+	time.Sleep(time.Second)
+	if !isManaged(pid) {
+		// cleanup got there first
+		return
+	}
+	_, err = respawnProcess(pid)
+	if err != nil {
+		cmdLogger(name).Error("---> %s", err)
+		sendNotification("safework: "+name+" restart failed", err.Error())
+	}
+}
+
+func restartWindow(cli CommandLine) time.Duration {
+	if cli.RestartWindow > 0 {
+		return cli.RestartWindow * time.Second
+	}
+	return time.Minute
+}
+
+// allowRestart counts restarts of cli within its window against
+// max_restarts, zero meaning no limit.
+func allowRestart(cli CommandLine) bool {
+	if cli.MaxRestarts <= 0 {
+		return true
+	}
+
+	managedMutex.Lock()
+	defer managedMutex.Unlock()
+
+	name := commandName(cli)
+	since := time.Now().Add(-restartWindow(cli))
+	var recent []time.Time
+	for _, t := range restartTimes[name] {
+		if t.After(since) {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= cli.MaxRestarts {
+		restartTimes[name] = recent
+		return false
+	}
+	restartTimes[name] = append(recent, time.Now())
+	return true
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSpec holds one bit per allowed value of each cron field.
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+var cronAliases = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCron parses "minute hour day-of-month month day-of-week" with *,
+// lists, ranges and steps, or one of the @ aliases.
+func parseCron(expr string) (*cronSpec, error) {
+	if alias, ok := cronAliases[strings.TrimSpace(expr)]; ok {
+		expr = alias
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: need 5 fields", expr)
+	}
+
+	c := &cronSpec{domStar: fields[2] == "*", dowStar: fields[4] == "*"}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	bits := [5]*uint64{&c.minute, &c.hour, &c.dom, &c.month, &c.dow}
+	for i, field := range fields {
+		v, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("cron %q: %s", expr, err)
+		}
+		*bits[i] = v
+	}
+
+	// 7 is Sunday too
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step %q", part)
+			}
+			rng, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		if rng != "*" {
+			a, b, found := strings.Cut(rng, "-")
+			var err error
+			lo, err = strconv.Atoi(a)
+			if err != nil {
+				return 0, fmt.Errorf("bad value %q", part)
+			}
+			hi = lo
+			if found {
+				hi, err = strconv.Atoi(b)
+				if err != nil {
+					return 0, fmt.Errorf("bad value %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// matches follows cron: when both day fields are restricted, either one
+// may match.
+func (c *cronSpec) matches(t time.Time) bool {
+	if c.minute&(1<<uint(t.Minute())) == 0 || c.hour&(1<<uint(t.Hour())) == 0 || c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func checkSchedules(cfg *Config) error {
+	for expr, task := range cfg.Schedules {
+		_, err := parseCron(expr)
+		if err != nil {
+			return err
+		}
+		if _, ok := cfg.Tasks[task]; !ok {
+			return fmt.Errorf("schedule %s: unknown task %s", expr, task)
+		}
+	}
+	return nil
+}
+
+// startScheduler checks the schedules at the start of every minute.
+func startScheduler() {
+	if len(config().Schedules) == 0 {
+		return
+	}
+
+	logInfo("[SCHEDULER STARTED]")
+	go func() {
+		for {
+			now := time.Now()
+			next := now.Truncate(time.Minute).Add(time.Minute)
+			time.Sleep(next.Sub(now))
+			runSchedules(next)
+		}
+	}()
+}
+
+func runSchedules(t time.Time) {
+	exprs := make([]string, 0, len(config().Schedules))
+	for expr := range config().Schedules {
+		exprs = append(exprs, expr)
+	}
+	sort.Strings(exprs)
+
+	for _, expr := range exprs {
+		spec, err := parseCron(expr)
+		if err != nil || !spec.matches(t) {
+			continue
+		}
+
+		task := config().Schedules[expr]
+		logSection("[SCHEDULE %s] %s", expr, task)
+		publishEvent(Event{Type: "schedule", Name: task, Text: expr})
+		go runTask(task)
+	}
+}
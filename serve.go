@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+)
+
+type (
+	rpcRequest struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id,omitempty"`
+		Method  string          `json:"method"`
+		Params  json.RawMessage `json:"params,omitempty"`
+	}
+
+	rpcError struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+
+	rpcMessage struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id,omitempty"`
+		Method  string          `json:"method,omitempty"`
+		Params  interface{}     `json:"params,omitempty"`
+		Result  interface{}     `json:"result,omitempty"`
+		Error   *rpcError       `json:"error,omitempty"`
+	}
+
+	rpcTask struct {
+		Name  string   `json:"name"`
+		Steps []string `json:"steps"`
+	}
+)
+
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000
+)
+
+// runServe implements `safework serve --stdio [config dir]`, newline
+// delimited JSON-RPC 2.0 for editor plugins. Tasks run in this process;
+// their events arrive as "event" notifications while they run.
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	stdio := fs.Bool("stdio", false, "speak JSON-RPC on stdin and stdout")
+	if fs.Parse(args) != nil {
+		return 2
+	}
+	if !*stdio || fs.NArg() > 1 {
+		fmt.Println("usage: safework serve --stdio [config dir]")
+		return 2
+	}
+
+	// stdout carries the protocol, console output goes to stderr
+	out := os.Stdout
+	os.Stdout = os.Stderr
+
+	err := loadConfig(fs.Arg(0))
+	if err == nil {
+		err = setupLogging(config().Log)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	var mu sync.Mutex
+	enc := json.NewEncoder(out)
+	send := func(m rpcMessage) {
+		m.JSONRPC = "2.0"
+		mu.Lock()
+		enc.Encode(m)
+		mu.Unlock()
+	}
+
+	// a flush request drains queued events, so a task's events always
+	// arrive before its result
+	events, cancel := subscribeEvents()
+	defer cancel()
+	flush := make(chan chan struct{})
+	go func() {
+		for {
+			select {
+			case e := <-events:
+				send(rpcMessage{Method: "event", Params: e})
+			case done := <-flush:
+				for drained := false; !drained; {
+					select {
+					case e := <-events:
+						send(rpcMessage{Method: "event", Params: e})
+					default:
+						drained = true
+					}
+				}
+				close(done)
+			}
+		}
+	}()
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 10<<20)
+	for scanner.Scan() {
+		var req rpcRequest
+		err := json.Unmarshal(scanner.Bytes(), &req)
+		if err != nil {
+			send(rpcMessage{ID: json.RawMessage("null"), Error: &rpcError{rpcParseError, err.Error()}})
+			continue
+		}
+		if req.Method == "exit" {
+			return 0
+		}
+
+		go func() {
+			result, rerr := handleRPC(req)
+			if req.ID == nil {
+				return
+			}
+			done := make(chan struct{})
+			flush <- done
+			<-done
+			if rerr != nil {
+				send(rpcMessage{ID: req.ID, Error: rerr})
+			} else {
+				send(rpcMessage{ID: req.ID, Result: result})
+			}
+		}()
+	}
+	return 0
+}
+
+func handleRPC(req rpcRequest) (interface{}, *rpcError) {
+	switch req.Method {
+	case "tasks.list":
+		tasks := []rpcTask{}
+		for _, name := range taskNames() {
+			task := rpcTask{Name: name, Steps: []string{}}
+			for _, cli := range config().Tasks[name] {
+				task.Steps = append(task.Steps, commandName(cli))
+			}
+			tasks = append(tasks, task)
+		}
+		return tasks, nil
+
+	case "tasks.run":
+		var params struct {
+			Name string `json:"name"`
+		}
+		if json.Unmarshal(req.Params, &params) != nil || params.Name == "" {
+			return nil, &rpcError{rpcInvalidParams, "tasks.run needs {\"name\": ...}"}
+		}
+		report, err := runTask(params.Name)
+		if report == nil {
+			return nil, &rpcError{rpcServerError, err.Error()}
+		}
+		return report.status(), nil
+
+	case "status":
+		return currentStatus(), nil
+
+	default:
+		return nil, &rpcError{rpcMethodNotFound, fmt.Sprintf("unknown method %s", req.Method)}
+	}
+}
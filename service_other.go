@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "fmt"
+
+func runService(args []string) int {
+	fmt.Println("ERR: windows services are only supported on Windows")
+	return 1
+}
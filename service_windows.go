@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const serviceName = "safework"
+
+var errNoServiceControl = errors.New("service mode needs a control api in commands.json")
+
+type windowsService struct {
+	dir string
+}
+
+// runService handles `safework service install|uninstall|run [config dir]`.
+func runService(args []string) int {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Println("usage: safework service install|uninstall|run [config dir]")
+		return 2
+	}
+
+	dir := ""
+	if len(args) > 1 {
+		dir = args[1]
+	}
+
+	var err error
+	switch args[0] {
+	case "install":
+		err = installService(resolveConfigDir(dir))
+	case "uninstall":
+		err = uninstallService()
+	case "run":
+		err = svc.Run(serviceName, &windowsService{dir: dir})
+	default:
+		err = fmt.Errorf("unknown service command %s", args[0])
+	}
+
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+func installService(dir string) error {
+	err := loadConfig(dir)
+	if err != nil {
+		return err
+	}
+	if config().Control == nil {
+		return errNoServiceControl
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already installed", serviceName)
+	}
+
+	s, err = m.CreateService(serviceName, exe, mgr.Config{
+		DisplayName: "safework",
+		Description: "Runs safework startup at boot and cleanup at service stop.",
+		StartType:   mgr.StartAutomatic,
+	}, "service", "run", dir)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	fmt.Printf("service %s installed for %s\n", serviceName, dir)
+	return nil
+}
+
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", serviceName)
+	}
+	defer s.Close()
+
+	err = s.Delete()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("service %s uninstalled\n", serviceName)
+	return nil
+}
+
+// Execute runs without hotkeys; the control API is the only interface.
+// Startup runs once the service reports running, cleanup on stop.
+func (s *windowsService) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+
+	err := startService(s.dir)
+	if err != nil {
+		logError("ERR: %s", err)
+		return true, exitStartup
+	}
+
+	changes <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	go func() {
+		defer recoverPanic()
+		report, err := runStartup()
+		if err != nil {
+			rollback(report)
+		}
+	}()
+
+	for c := range r {
+		switch c.Cmd {
+		case svc.Interrogate:
+			changes <- c.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			changes <- svc.Status{State: svc.StopPending}
+			if cleanup() != nil {
+				return true, exitCleanup
+			}
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+func startService(dir string) error {
+	err := loadConfig(dir)
+	if err == nil {
+		err = setupLogging(config().Log)
+	}
+	if err != nil {
+		return err
+	}
+
+	path := configuredLogFile()
+	if path == "" {
+		path = logFilePath()
+	}
+	err = openLogFile(path)
+	if err != nil {
+		return err
+	}
+
+	err = lockInstance()
+	if err != nil {
+		return err
+	}
+	if config().Control == nil {
+		return errNoServiceControl
+	}
+	recoverState(false)
+	return startServers()
+}
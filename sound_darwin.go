@@ -0,0 +1,15 @@
+package main
+
+import "os/exec"
+
+func playSound(sound string) error {
+	switch sound {
+	case "success":
+		sound = "/System/Library/Sounds/Glass.aiff"
+	case "failure":
+		sound = "/System/Library/Sounds/Basso.aiff"
+	case "beep":
+		return exec.Command("osascript", "-e", "beep").Run()
+	}
+	return exec.Command("afplay", sound).Run()
+}
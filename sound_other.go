@@ -0,0 +1,25 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+func playSound(sound string) error {
+	switch sound {
+	case "success":
+		sound = "/usr/share/sounds/freedesktop/stereo/complete.oga"
+	case "failure":
+		sound = "/usr/share/sounds/freedesktop/stereo/dialog-error.oga"
+	case "beep":
+		fmt.Print("\a")
+		return nil
+	}
+
+	if _, err := exec.LookPath("paplay"); err == nil {
+		return exec.Command("paplay", sound).Run()
+	}
+	return exec.Command("aplay", "-q", sound).Run()
+}
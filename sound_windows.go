@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+func playSound(sound string) error {
+	var script string
+	switch sound {
+	case "success":
+		script = "[System.Media.SystemSounds]::Asterisk.Play(); Start-Sleep -Milliseconds 500"
+	case "failure":
+		script = "[System.Media.SystemSounds]::Hand.Play(); Start-Sleep -Milliseconds 500"
+	case "beep":
+		script = "[console]::beep(800, 300)"
+	default:
+		script = "(New-Object Media.SoundPlayer $env:SAFEWORK_SOUND).PlaySync()"
+	}
+
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+	cmd.Env = append(os.Environ(), "SAFEWORK_SOUND="+sound)
+	return cmd.Run()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type (
+	// sessionState is what a crashed instance leaves behind, so the next
+	// one can find the processes it started.
+	sessionState struct {
+		Pid       int            `json:"pid"`
+		Started   time.Time      `json:"started"`
+		Boot      string         `json:"boot,omitempty"`
+		Processes []stateProcess `json:"processes"`
+	}
+
+	// Identity is the process start time, a pid alone may have been
+	// reused by an unrelated process since
+	stateProcess struct {
+		ManagedProcess
+		Command  *CommandLine `json:"command,omitempty"`
+		Identity string       `json:"identity,omitempty"`
+	}
+)
+
+var (
+	resumeMode     bool
+	stateEnabled   bool
+	sessionStarted = time.Now()
+)
+
+func stateFilePath() string {
+	return filepath.Join(configDir, "safework-state.json")
+}
+
+// saveState records the managed processes, and removes the state file
+// once there are none. Only the instance holding the lock writes it.
+// Callers hold managedMutex.
+func saveState() {
+	if !stateEnabled {
+		return
+	}
+
+	if len(managedProcs) == 0 {
+		os.Remove(stateFilePath())
+		return
+	}
+
+	state := sessionState{Pid: os.Getpid(), Started: sessionStarted, Boot: bootID()}
+	for _, p := range managedProcs {
+		state.Processes = append(state.Processes, stateProcess{*p, p.cli, p.identity})
+	}
+	// the commands may carry secrets in args and env
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(stateFilePath(), b, 0600)
+	}
+	if err == nil {
+		// a file written by an older version keeps its mode otherwise
+		err = os.Chmod(stateFilePath(), 0600)
+	}
+	if err != nil {
+		logError("ERR: state file, %s", err)
+	}
+}
+
+// recoverState looks for processes left by an instance that did not
+// clean up. With resume they are adopted, otherwise they are stopped
+// before startup runs again. Only processes whose start time still
+// matches are touched, and nothing survives a reboot. It reports whether
+// anything was adopted.
+func recoverState(resume bool) bool {
+	stateEnabled = true
+	b, err := ioutil.ReadFile(stateFilePath())
+	if err != nil {
+		return false
+	}
+
+	var state sessionState
+	err = json.Unmarshal(b, &state)
+	if err != nil || state.Pid == os.Getpid() {
+		return false
+	}
+
+	if boot := bootID(); state.Boot != boot {
+		logInfo("state file from before a reboot, ignored")
+		os.Remove(stateFilePath())
+		return false
+	}
+
+	var orphans []stateProcess
+	for _, p := range state.Processes {
+		if p.Identity != "" && processAlive(p.Pid) && processStartID(p.Pid) == p.Identity {
+			orphans = append(orphans, p)
+		}
+	}
+	if len(orphans) == 0 {
+		os.Remove(stateFilePath())
+		return false
+	}
+
+	logSection("[ORPHANED PROCESSES] from pid %d, started %s", state.Pid, state.Started.Format("2006-01-02 15:04:05"))
+	managedMutex.Lock()
+	defer managedMutex.Unlock()
+
+	for i := range orphans {
+		p := orphans[i].ManagedProcess
+		p.identity = orphans[i].Identity
+		if !resume {
+			stopProcess(&p)
+			continue
+		}
+
+		logInfo("adopt: %s (pid %d)", p.Name, p.Pid)
+		p.cli = orphans[i].Command
+		managedProcs = append(managedProcs, &p)
+	}
+	saveState()
+	return resume
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	deckMessage struct {
+		Event   string `json:"event"`
+		Action  string `json:"action,omitempty"`
+		Context string `json:"context,omitempty"`
+		Payload struct {
+			Settings deckSettings `json:"settings"`
+		} `json:"payload"`
+	}
+
+	deckSettings struct {
+		Config string `json:"config"`
+		Name   string `json:"name"`
+	}
+
+	deckKey struct {
+		action   string
+		settings deckSettings
+	}
+
+	wsConn struct {
+		conn net.Conn
+		r    *bufio.Reader
+		mu   sync.Mutex
+	}
+)
+
+// isStreamDeckLaunch reports whether Stream Deck started the binary as the
+// plugin in streamdeck/com.safework.sdPlugin.
+func isStreamDeckLaunch(args []string) bool {
+	for _, arg := range args {
+		if arg == "-registerEvent" {
+			return true
+		}
+	}
+	return false
+}
+
+// runStreamDeck speaks the Stream Deck plugin protocol and forwards key
+// presses to running instances over their ipc socket.
+func runStreamDeck(args []string) int {
+	fs := flag.NewFlagSet("streamdeck", flag.ContinueOnError)
+	port := fs.Int("port", 0, "")
+	uuid := fs.String("pluginUUID", "", "")
+	register := fs.String("registerEvent", "", "")
+	fs.String("info", "", "")
+	if fs.Parse(args) != nil {
+		return 2
+	}
+
+	ws, err := dialWebSocket(fmt.Sprintf("127.0.0.1:%d", *port))
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+	ws.writeJSON(map[string]string{"event": *register, "uuid": *uuid})
+
+	var mu sync.Mutex
+	keys := make(map[string]deckKey)
+
+	go func() {
+		for {
+			time.Sleep(5 * time.Second)
+			mu.Lock()
+			snapshot := make(map[string]deckKey, len(keys))
+			for ctx, key := range keys {
+				snapshot[ctx] = key
+			}
+			mu.Unlock()
+
+			for ctx, key := range snapshot {
+				if key.action == "com.safework.task" {
+					updateDeckKey(ws, ctx, key.settings)
+				}
+			}
+		}
+	}()
+
+	for {
+		b, err := ws.readMessage()
+		if err != nil {
+			return 0
+		}
+
+		var msg deckMessage
+		if json.Unmarshal(b, &msg) != nil {
+			continue
+		}
+
+		switch msg.Event {
+		case "willAppear", "didReceiveSettings":
+			mu.Lock()
+			keys[msg.Context] = deckKey{msg.Action, msg.Payload.Settings}
+			mu.Unlock()
+		case "willDisappear":
+			mu.Lock()
+			delete(keys, msg.Context)
+			mu.Unlock()
+		case "keyDown":
+			go pressDeckKey(ws, msg)
+		}
+	}
+}
+
+func pressDeckKey(ws *wsConn, msg deckMessage) {
+	s := msg.Payload.Settings
+	if s.Config == "" || s.Name == "" {
+		ws.writeJSON(map[string]string{"event": "showAlert", "context": msg.Context})
+		return
+	}
+
+	var err error
+	if msg.Action == "com.safework.task" {
+		ws.writeJSON(map[string]interface{}{"event": "setTitle", "context": msg.Context, "payload": map[string]string{"title": "running"}})
+		_, err = ipcCall(resolveConfigDir(s.Config), "run", s.Name)
+		updateDeckKey(ws, msg.Context, s)
+	} else {
+		_, err = ipcCall(resolveConfigDir(s.Config), "trigger", strings.Split(s.Name, ",")...)
+	}
+
+	event := "showOk"
+	if err != nil {
+		event = "showAlert"
+	}
+	ws.writeJSON(map[string]string{"event": event, "context": msg.Context})
+}
+
+// updateDeckKey shows the status of the task's last run on its key.
+func updateDeckKey(ws *wsConn, ctx string, s deckSettings) {
+	title, state := "off", 1
+	if b, err := ipcCall(resolveConfigDir(s.Config), "status"); err == nil {
+		var status instanceStatus
+		json.Unmarshal(b, &status)
+		title, state = "idle", 0
+		if r, ok := status.Tasks[s.Name]; ok {
+			title = r.Status
+			if r.Status == "failed" {
+				state = 1
+			}
+		}
+	}
+
+	ws.writeJSON(map[string]interface{}{"event": "setTitle", "context": ctx, "payload": map[string]string{"title": title}})
+	ws.writeJSON(map[string]interface{}{"event": "setState", "context": ctx, "payload": map[string]int{"state": state}})
+}
+
+// dialWebSocket opens a plain ws:// connection, which is all Stream Deck
+// needs.
+func dialWebSocket(addr string) (*wsConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", addr, key)
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		conn.Close()
+		return nil, errors.New("websocket handshake failed")
+	}
+	return &wsConn{conn: conn, r: r}, nil
+}
+
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, 0x80|byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 0x80|126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		header = append(append(header, 0x80|127), ext[:]...)
+	}
+
+	// clients must mask every frame
+	mask := make([]byte, 4)
+	rand.Read(mask)
+	masked := make([]byte, len(payload))
+	for i := range payload {
+		masked[i] = payload[i] ^ mask[i%4]
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	_, err := ws.conn.Write(append(append(header, mask...), masked...))
+	return err
+}
+
+func (ws *wsConn) writeJSON(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ws.writeFrame(0x1, b)
+}
+
+// readMessage returns the next text or binary message, answering pings and
+// joining fragments.
+func (ws *wsConn) readMessage() ([]byte, error) {
+	var msg []byte
+	for {
+		var head [2]byte
+		_, err := io.ReadFull(ws.r, head[:])
+		if err != nil {
+			return nil, err
+		}
+
+		n := uint64(head[1] & 0x7F)
+		switch n {
+		case 126:
+			var ext [2]byte
+			_, err = io.ReadFull(ws.r, ext[:])
+			n = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			_, err = io.ReadFull(ws.r, ext[:])
+			n = binary.BigEndian.Uint64(ext[:])
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n > 16<<20 {
+			return nil, errors.New("websocket frame too large")
+		}
+
+		payload := make([]byte, n)
+		_, err = io.ReadFull(ws.r, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode := head[0] & 0x0F; opcode {
+		case 0x8:
+			return nil, io.EOF
+		case 0x9:
+			ws.writeFrame(0xA, payload)
+			continue
+		case 0xA:
+			continue
+		}
+
+		msg = append(msg, payload...)
+		if head[0]&0x80 != 0 {
+			return msg, nil
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"time"
+)
+
+func watchSystemEvents() error {
+	if hasTrigger("sleep") {
+		return errors.New("sleep triggers are not supported on macOS, use wake")
+	}
+	if hasTrigger("lock") || hasTrigger("unlock") {
+		locked, err := screenLocked()
+		if err != nil {
+			return err
+		}
+		go pollScreenLock(locked)
+	}
+	if hasTrigger("wake") {
+		go pollWake()
+	}
+	return nil
+}
+
+// pollWake detects a wake by the wall clock running ahead of the
+// monotonic clock, which stops while the Mac sleeps.
+func pollWake() {
+	last := time.Now()
+	for range time.Tick(5 * time.Second) {
+		now := time.Now()
+		if now.Round(0).Sub(last.Round(0))-now.Sub(last) > 30*time.Second {
+			fireTrigger("wake", "")
+		}
+		last = now
+	}
+}
+
+// screenLocked reads the console session flags, which need no cgo.
+func screenLocked() (bool, error) {
+	out, err := exec.Command("ioreg", "-n", "Root", "-d1").Output()
+	if err != nil {
+		return false, err
+	}
+	return bytes.Contains(out, []byte(`"CGSSessionScreenIsLocked"=Yes`)), nil
+}
+
+func pollScreenLock(locked bool) {
+	for range time.Tick(2 * time.Second) {
+		now, err := screenLocked()
+		if err != nil || now == locked {
+			continue
+		}
+
+		locked = now
+		if locked {
+			fireTrigger("lock", "")
+		} else {
+			fireTrigger("unlock", "")
+		}
+	}
+}
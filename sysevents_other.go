@@ -0,0 +1,120 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"syscall"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func watchSystemEvents() error {
+	if hasTrigger("lock") || hasTrigger("unlock") {
+		err := watchScreenSaver()
+		if err != nil {
+			return err
+		}
+	}
+	if hasTrigger("sleep") || hasTrigger("wake") {
+		return watchSleep()
+	}
+	return nil
+}
+
+// watchScreenSaver follows the screensaver ActiveChanged signal, which
+// GNOME, KDE and most lockers send when the session locks or unlocks.
+func watchScreenSaver() error {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+
+	for _, iface := range []string{"org.freedesktop.ScreenSaver", "org.gnome.ScreenSaver"} {
+		err = conn.AddMatchSignal(dbus.WithMatchInterface(iface), dbus.WithMatchMember("ActiveChanged"))
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+	go func() {
+		locked := false
+		for s := range signals {
+			if len(s.Body) == 0 {
+				continue
+			}
+			active, ok := s.Body[0].(bool)
+			if !ok || active == locked {
+				continue
+			}
+
+			locked = active
+			if locked {
+				fireTrigger("lock", "")
+			} else {
+				fireTrigger("unlock", "")
+			}
+		}
+	}()
+	return nil
+}
+
+// watchSleep follows logind's PrepareForSleep. A delay inhibitor holds
+// off suspend until the sleep triggers have run.
+func watchSleep() error {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return err
+	}
+
+	err = conn.AddMatchSignal(dbus.WithMatchInterface("org.freedesktop.login1.Manager"), dbus.WithMatchMember("PrepareForSleep"))
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	login := conn.Object("org.freedesktop.login1", "/org/freedesktop/login1")
+	inhibit := func() int {
+		if !hasTrigger("sleep") {
+			return -1
+		}
+		var fd dbus.UnixFD
+		err := login.Call("org.freedesktop.login1.Manager.Inhibit", 0, "sleep", "safework", "run sleep triggers", "delay").Store(&fd)
+		if err != nil {
+			logError("ERR: sleep inhibitor, %s", err)
+			return -1
+		}
+		return int(fd)
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+	go func() {
+		lock := inhibit()
+		for s := range signals {
+			if len(s.Body) == 0 {
+				continue
+			}
+			sleeping, ok := s.Body[0].(bool)
+			if !ok {
+				continue
+			}
+
+			if sleeping {
+				fireTrigger("sleep", "")
+				if lock >= 0 {
+					syscall.Close(lock)
+					lock = -1
+				}
+			} else {
+				if lock < 0 {
+					lock = inhibit()
+				}
+				fireTrigger("wake", "")
+			}
+		}
+	}()
+	return nil
+}
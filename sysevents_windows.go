@@ -0,0 +1,144 @@
+package main
+
+import (
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	wmWTSSessionChange = 0x02B1
+	wmPowerBroadcast   = 0x0218
+
+	pbtAPMSuspend         = 0x4
+	pbtAPMResumeAutomatic = 0x12
+
+	wtsSessionLock   = 0x7
+	wtsSessionUnlock = 0x8
+)
+
+var (
+	procRegisterClassExW               = user32.NewProc("RegisterClassExW")
+	procCreateWindowExW                = user32.NewProc("CreateWindowExW")
+	procDefWindowProcW                 = user32.NewProc("DefWindowProcW")
+	procGetMessageW                    = user32.NewProc("GetMessageW")
+	procTranslateMessage               = user32.NewProc("TranslateMessage")
+	procDispatchMessageW               = user32.NewProc("DispatchMessageW")
+	procGetModuleHandleW               = syscall.NewLazyDLL("kernel32.dll").NewProc("GetModuleHandleW")
+	procWTSRegisterSessionNotification = syscall.NewLazyDLL("wtsapi32.dll").NewProc("WTSRegisterSessionNotification")
+
+	systemEvents = make(chan string, 16)
+)
+
+type (
+	wndClassEx struct {
+		Size       uint32
+		Style      uint32
+		WndProc    uintptr
+		ClsExtra   int32
+		WndExtra   int32
+		Instance   uintptr
+		Icon       uintptr
+		Cursor     uintptr
+		Background uintptr
+		MenuName   *uint16
+		ClassName  *uint16
+		IconSm     uintptr
+	}
+
+	winMsg struct {
+		Hwnd    uintptr
+		Message uint32
+		WParam  uintptr
+		LParam  uintptr
+		Time    uint32
+		Pt      struct{ X, Y int32 }
+		Private uint32
+	}
+)
+
+// watchSystemEvents creates a hidden top-level window, since session and
+// power notifications are only sent to windows.
+func watchSystemEvents() error {
+	ready := make(chan error)
+	go func() {
+		runtime.LockOSThread()
+
+		hwnd, err := createEventWindow()
+		ready <- err
+		if err != nil {
+			return
+		}
+
+		var m winMsg
+		for {
+			ret, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&m)), hwnd, 0, 0)
+			if int32(ret) <= 0 {
+				return
+			}
+			procTranslateMessage.Call(uintptr(unsafe.Pointer(&m)))
+			procDispatchMessageW.Call(uintptr(unsafe.Pointer(&m)))
+		}
+	}()
+
+	// handle events in order, without blocking the message loop
+	go func() {
+		for event := range systemEvents {
+			fireTrigger(event, "")
+		}
+	}()
+	return <-ready
+}
+
+func createEventWindow() (uintptr, error) {
+	instance, _, _ := procGetModuleHandleW.Call(0)
+	className, _ := syscall.UTF16PtrFromString("safeworkEvents")
+
+	wc := wndClassEx{
+		WndProc:   syscall.NewCallback(eventWindowProc),
+		Instance:  instance,
+		ClassName: className,
+	}
+	wc.Size = uint32(unsafe.Sizeof(wc))
+	ret, _, err := procRegisterClassExW.Call(uintptr(unsafe.Pointer(&wc)))
+	if ret == 0 {
+		return 0, err
+	}
+
+	hwnd, _, err := procCreateWindowExW.Call(0, uintptr(unsafe.Pointer(className)), uintptr(unsafe.Pointer(className)),
+		0, 0, 0, 0, 0, 0, 0, instance, 0)
+	if hwnd == 0 {
+		return 0, err
+	}
+
+	if hasTrigger("lock") || hasTrigger("unlock") {
+		ret, _, err = procWTSRegisterSessionNotification.Call(hwnd, 0)
+		if ret == 0 {
+			return 0, err
+		}
+	}
+	return hwnd, nil
+}
+
+func eventWindowProc(hwnd, msg, wParam, lParam uintptr) uintptr {
+	switch msg {
+	case wmWTSSessionChange:
+		switch wParam {
+		case wtsSessionLock:
+			systemEvents <- "lock"
+		case wtsSessionUnlock:
+			systemEvents <- "unlock"
+		}
+	case wmPowerBroadcast:
+		switch wParam {
+		case pbtAPMSuspend:
+			// Windows waits for this message before it suspends
+			fireTrigger("sleep", "")
+		case pbtAPMResumeAutomatic:
+			systemEvents <- "wake"
+		}
+	}
+
+	ret, _, _ := procDefWindowProcW.Call(hwnd, msg, wParam, lParam)
+	return ret
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package main
+
+import "log/syslog"
+
+func openSystemLog() (func(level int, msg string), error) {
+	w, err := syslog.New(syslog.LOG_WARNING|syslog.LOG_USER, "safework")
+	if err != nil {
+		return nil, err
+	}
+	return func(level int, msg string) {
+		if level >= levelError {
+			w.Err(msg)
+		} else {
+			w.Warning(msg)
+		}
+	}, nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import "golang.org/x/sys/windows/svc/eventlog"
+
+// openSystemLog writes to the Application event log. Registering the
+// source needs an administrator once, without it Windows still shows the
+// messages with a note that the source is unknown.
+func openSystemLog() (func(level int, msg string), error) {
+	eventlog.InstallAsEventCreate("safework", eventlog.Error|eventlog.Warning|eventlog.Info)
+	l, err := eventlog.Open("safework")
+	if err != nil {
+		return nil, err
+	}
+	return func(level int, msg string) {
+		if level >= levelError {
+			l.Error(1, msg)
+		} else {
+			l.Warning(1, msg)
+		}
+	}, nil
+}
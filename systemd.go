@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const systemdUnit = `[Unit]
+Description=safework
+After=graphical-session.target
+PartOf=graphical-session.target
+
+[Service]
+Type=notify
+NotifyAccess=main
+ExecStart=%s %s
+ExecStop=%s stop %s
+TimeoutStartSec=infinity
+TimeoutStopSec=5min
+WatchdogSec=30
+
+[Install]
+WantedBy=graphical-session.target
+`
+
+// sdNotify sends a state update to systemd when running as a notify
+// service, and does nothing otherwise.
+func sdNotify(state string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	if addr[0] == '@' {
+		addr = "\x00" + addr[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// startWatchdog pings systemd at half the configured watchdog interval.
+func startWatchdog() {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+
+	go func() {
+		for range time.Tick(time.Duration(usec) * time.Microsecond / 2) {
+			sdNotify("WATCHDOG=1")
+		}
+	}()
+}
+
+// runSystemd handles `safework systemd install [config dir]`.
+func runSystemd(args []string) int {
+	if len(args) == 0 || len(args) > 2 || args[0] != "install" {
+		fmt.Println("usage: safework systemd install [config dir]")
+		return 2
+	}
+
+	dir := ""
+	if len(args) > 1 {
+		dir = args[1]
+	}
+
+	path, err := installSystemdUnit(resolveConfigDir(dir))
+	if err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+
+	fmt.Printf("unit written: %s\n", path)
+	fmt.Println("enable it with: systemctl --user daemon-reload && systemctl --user enable --now safework")
+	return 0
+}
+
+func installSystemdUnit(dir string) (string, error) {
+	if runtime.GOOS != "linux" {
+		return "", errors.New("systemd units are only supported on Linux")
+	}
+
+	err := loadConfig(dir)
+	if err != nil {
+		return "", err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(base, "systemd", "user", "safework.service")
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	exe, dir = systemdQuote(exe), systemdQuote(dir)
+	unit := fmt.Sprintf(systemdUnit, exe, dir, exe, dir)
+	return path, ioutil.WriteFile(path, []byte(unit), 0644)
+}
+
+// systemdQuote quotes s for an Exec line, where % starts a specifier.
+func systemdQuote(s string) string {
+	return strconv.Quote(strings.ReplaceAll(s, "%", "%%"))
+}
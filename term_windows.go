@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// makeRaw switches the console to reading single keys without echo, with
+// arrow keys as escape sequences, and returns a function that restores it.
+func makeRaw(f *os.File) (func(), error) {
+	h := windows.Handle(f.Fd())
+	var old uint32
+	err := windows.GetConsoleMode(h, &old)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := old &^ (windows.ENABLE_ECHO_INPUT | windows.ENABLE_LINE_INPUT | windows.ENABLE_PROCESSED_INPUT)
+	err = windows.SetConsoleMode(h, raw|windows.ENABLE_VIRTUAL_TERMINAL_INPUT)
+	if err != nil {
+		return nil, err
+	}
+	return func() { windows.SetConsoleMode(h, old) }, nil
+}
+
+func terminalSize(f *os.File) (int, int) {
+	var info windows.ConsoleScreenBufferInfo
+	err := windows.GetConsoleScreenBufferInfo(windows.Handle(f.Fd()), &info)
+	if err != nil {
+		return 80, 24
+	}
+	return int(info.Window.Right-info.Window.Left) + 1, int(info.Window.Bottom-info.Window.Top) + 1
+}
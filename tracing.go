@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TracingConfig sends an OTLP trace of each startup, task and cleanup run
+// to a collector, with a span per step. Endpoint is the collector's
+// OTLP/HTTP address, /v1/traces is added when it has no path.
+type TracingConfig struct {
+	Endpoint string            `json:"endpoint"`
+	Service  string            `json:"service,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+
+type (
+	otlpValue struct {
+		StringValue *string `json:"stringValue,omitempty"`
+		IntValue    *string `json:"intValue,omitempty"`
+		BoolValue   *bool   `json:"boolValue,omitempty"`
+	}
+
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+
+	otlpSpan struct {
+		TraceID      string          `json:"traceId"`
+		SpanID       string          `json:"spanId"`
+		ParentSpanID string          `json:"parentSpanId,omitempty"`
+		Name         string          `json:"name"`
+		Kind         int             `json:"kind"`
+		Start        string          `json:"startTimeUnixNano"`
+		End          string          `json:"endTimeUnixNano"`
+		Attributes   []otlpAttribute `json:"attributes,omitempty"`
+		Status       otlpStatus      `json:"status"`
+	}
+)
+
+var (
+	retriesMutex sync.Mutex
+	stepRetries  = make(map[string]int)
+
+	// pendingPosts lets a one-shot run wait for traces and alerts that
+	// are still being sent
+	pendingPosts sync.WaitGroup
+)
+
+func postAsync(fn func()) {
+	pendingPosts.Add(1)
+	go func() {
+		defer pendingPosts.Done()
+		fn()
+	}()
+}
+
+// countRetries records the extra attempts a wait macro needed, picked up
+// by the step that ran it.
+func countRetries(name string, n int) {
+	retriesMutex.Lock()
+	stepRetries[name] += n
+	retriesMutex.Unlock()
+}
+
+func takeRetries(name string) int {
+	retriesMutex.Lock()
+	defer retriesMutex.Unlock()
+
+	n := stepRetries[name]
+	delete(stepRetries, name)
+	return n
+}
+
+// exitCode returns the exit code of a failed command, 0 for success and
+// -1 when there is none, such as a macro error.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+func stringAttr(key, value string) otlpAttribute {
+	return otlpAttribute{key, otlpValue{StringValue: &value}}
+}
+
+func intAttr(key string, value int) otlpAttribute {
+	s := strconv.Itoa(value)
+	return otlpAttribute{key, otlpValue{IntValue: &s}}
+}
+
+func boolAttr(key string, value bool) otlpAttribute {
+	return otlpAttribute{key, otlpValue{BoolValue: &value}}
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func tracesURL(endpoint string) (string, error) {
+	u, err := url.Parse(os.ExpandEnv(endpoint))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("bad endpoint %q, use http:// or https://", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/traces"
+	}
+	return u.String(), nil
+}
+
+// spans builds the root span of the run and a child span per step.
+func (r *RunReport) spans() []otlpSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	traceID, rootID := randomID(16), randomID(8)
+	root := otlpSpan{
+		TraceID: traceID,
+		SpanID:  rootID,
+		Name:    r.Title,
+		Kind:    1,
+		Start:   unixNano(r.Start),
+		End:     unixNano(r.End),
+		Status:  otlpStatus{Code: 1},
+	}
+	failed := 0
+	spans := []otlpSpan{}
+	for _, step := range r.Steps {
+		span := otlpSpan{
+			TraceID:      traceID,
+			SpanID:       randomID(8),
+			ParentSpanID: rootID,
+			Name:         step.Name,
+			Kind:         1,
+			Start:        unixNano(step.Start),
+			End:          unixNano(step.Start.Add(step.Duration)),
+			Attributes: []otlpAttribute{
+				stringAttr("safework.status", step.Status),
+				intAttr("safework.retries", step.Retries),
+			},
+			Status: otlpStatus{Code: 1},
+		}
+		if step.Status != "skipped" && step.ExitCode >= 0 {
+			span.Attributes = append(span.Attributes, intAttr("process.exit_code", step.ExitCode))
+		}
+		if step.Err != nil {
+			span.Status = otlpStatus{Code: 2, Message: step.Err.Error()}
+			span.Attributes = append(span.Attributes, boolAttr("safework.ignored", step.Ignored))
+			if !step.Ignored {
+				failed++
+			}
+		}
+		spans = append(spans, span)
+	}
+
+	root.Attributes = []otlpAttribute{intAttr("safework.steps", len(r.Steps)), intAttr("safework.failed", failed)}
+	if r.Err != nil {
+		root.Status = otlpStatus{Code: 2, Message: r.Err.Error()}
+	} else if failed > 0 {
+		root.Status = otlpStatus{Code: 2, Message: fmt.Sprintf("%d steps failed", failed)}
+	}
+	return append([]otlpSpan{root}, spans...)
+}
+
+// exportTrace posts the trace of a finished run, if tracing is set up.
+func exportTrace(r *RunReport) {
+	cfg := config().Tracing
+	if cfg == nil || cfg.Endpoint == "" {
+		return
+	}
+	err := postTrace(cfg, r.spans())
+	if err != nil {
+		logError("ERR: tracing, %s", err)
+	}
+}
+
+func postTrace(cfg *TracingConfig, spans []otlpSpan) error {
+	endpoint, err := tracesURL(cfg.Endpoint)
+	if err != nil {
+		return err
+	}
+	service := cfg.Service
+	if service == "" {
+		service = "safework"
+	}
+
+	type scopeSpans struct {
+		Scope struct {
+			Name string `json:"name"`
+		} `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	type resourceSpans struct {
+		Resource struct {
+			Attributes []otlpAttribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []scopeSpans `json:"scopeSpans"`
+	}
+
+	var rs resourceSpans
+	host, _ := os.Hostname()
+	rs.Resource.Attributes = []otlpAttribute{stringAttr("service.name", service), stringAttr("host.name", host)}
+	ss := scopeSpans{Spans: spans}
+	ss.Scope.Name = "safework"
+	rs.ScopeSpans = []scopeSpans{ss}
+
+	body, err := json.Marshal(struct {
+		ResourceSpans []resourceSpans `json:"resourceSpans"`
+	}{[]resourceSpans{rs}})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"fyne.io/systray"
+)
+
+const (
+	trayIdle     = "idle"
+	trayStarting = "starting"
+	trayReady    = "ready"
+	trayFailed   = "failed"
+)
+
+var (
+	//go:embed icon.png
+	iconPNG []byte
+
+	trayMode       bool
+	trayMutex      sync.Mutex
+	trayIcons      = map[string][]byte{}
+	hotKeysPaused  int32
+	trayStateColor = map[string]color.RGBA{
+		trayStarting: {0xf0, 0xb4, 0x29, 0xff},
+		trayReady:    {0x2e, 0xb8, 0x4b, 0xff},
+		trayFailed:   {0xd9, 0x35, 0x35, 0xff},
+	}
+)
+
+// runTray shows the tray icon and runs startup behind it. It holds the
+// main thread until Quit.
+func runTray(startup bool) {
+	systray.Run(func() {
+		systray.SetTooltip("safework")
+		setTrayState(trayStarting)
+		buildTrayMenu()
+
+		go listenHotKeys()
+		if !startup {
+			setTrayState(trayReady)
+			return
+		}
+		go func() {
+			defer recoverPanic()
+			report, err := runStartup()
+			if err != nil && !errors.Is(err, errCanceled) {
+				rollbackStartup(report)
+			}
+		}()
+	}, nil)
+	// Quit has run cleanup already
+	exitAfterCleanup(exitOK)
+}
+
+func buildTrayMenu() {
+	startup := systray.AddMenuItem("Run Startup", "run startup commands")
+	clean := systray.AddMenuItem("Run Cleanup", "run cleanup commands")
+	onTrayClick(startup, func() {
+		report, err := runStartup()
+		if err != nil {
+			rollback(report)
+		}
+	})
+	onTrayClick(clean, func() {
+		cleanup()
+		setTrayState(trayIdle)
+	})
+
+	if names := taskNames(); len(names) > 0 {
+		tasks := systray.AddMenuItem("Tasks", "")
+		for _, name := range names {
+			name := name
+			onTrayClick(tasks.AddSubMenuItem(name, ""), func() {
+				runTask(name)
+			})
+		}
+	}
+
+	systray.AddSeparator()
+	pause := systray.AddMenuItemCheckbox("Pause Hotkeys", "ignore global hotkeys", false)
+	go func() {
+		for range pause.ClickedCh {
+			if pause.Checked() {
+				pause.Uncheck()
+				atomic.StoreInt32(&hotKeysPaused, 0)
+				logInfo("[HOTKEYS RESUMED]")
+			} else {
+				pause.Check()
+				atomic.StoreInt32(&hotKeysPaused, 1)
+				logInfo("[HOTKEYS PAUSED]")
+			}
+		}
+	}()
+	logs := systray.AddMenuItem("Open Logs", configuredLogFile())
+	onTrayClick(logs, func() {
+		err := openURL("", configuredLogFile())
+		if err != nil {
+			logError("ERR: %s", err)
+		}
+	})
+
+	systray.AddSeparator()
+	quit := systray.AddMenuItem("Quit", "run cleanup and quit")
+	onTrayClick(quit, func() {
+		cleanup()
+		systray.Quit()
+	})
+}
+
+// onTrayClick runs fn for each click, skipping clicks while it is busy.
+func onTrayClick(item *systray.MenuItem, fn func()) {
+	var busy int32
+	go func() {
+		for range item.ClickedCh {
+			if !atomic.CompareAndSwapInt32(&busy, 0, 1) {
+				continue
+			}
+			go func() {
+				defer recoverPanic()
+				defer atomic.StoreInt32(&busy, 0)
+				fn()
+			}()
+		}
+	}()
+}
+
+func setTrayState(state string) {
+	if !trayMode {
+		return
+	}
+
+	icon, err := trayIcon(state)
+	if err != nil {
+		logError("ERR: tray icon, %s", err)
+		return
+	}
+	systray.SetIcon(icon)
+	systray.SetTooltip("safework: " + state)
+}
+
+// trayIcon scales the app icon down and marks it with a state dot.
+// Windows needs the PNG wrapped in an ICO container.
+func trayIcon(state string) ([]byte, error) {
+	trayMutex.Lock()
+	defer trayMutex.Unlock()
+
+	if icon, ok := trayIcons[state]; ok {
+		return icon, nil
+	}
+
+	src, err := png.Decode(bytes.NewReader(iconPNG))
+	if err != nil {
+		return nil, err
+	}
+
+	const size = 64
+	img := scaleImage(src, size)
+	if c, ok := trayStateColor[state]; ok {
+		cx, cy, r := size-14, size-14, 12
+		for y := cy - r; y <= cy+r; y++ {
+			for x := cx - r; x <= cx+r; x++ {
+				if (x-cx)*(x-cx)+(y-cy)*(y-cy) <= r*r {
+					img.Set(x, y, c)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+
+	icon := buf.Bytes()
+	if runtime.GOOS == "windows" {
+		icon = wrapICO(icon, size)
+	}
+	trayIcons[state] = icon
+	return icon, nil
+}
+
+// scaleImage box-filters src into a size x size image.
+func scaleImage(src image.Image, size int) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/size, b.Min.Y+(y+1)*b.Dy()/size
+		for x := 0; x < size; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/size, b.Min.X+(x+1)*b.Dx()/size
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+cr, g+cg, bl+cb, a+ca, n+1
+				}
+			}
+			if n > 0 {
+				dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+			}
+		}
+	}
+	return dst
+}
+
+func wrapICO(pngData []byte, size int) []byte {
+	var hdr [22]byte
+	binary.LittleEndian.PutUint16(hdr[2:], 1) // type: icon
+	binary.LittleEndian.PutUint16(hdr[4:], 1) // one image
+	hdr[6], hdr[7] = byte(size), byte(size)
+	binary.LittleEndian.PutUint16(hdr[10:], 1)  // planes
+	binary.LittleEndian.PutUint16(hdr[12:], 32) // bits per pixel
+	binary.LittleEndian.PutUint32(hdr[14:], uint32(len(pngData)))
+	binary.LittleEndian.PutUint32(hdr[18:], uint32(len(hdr)))
+	return append(hdr[:], pngData...)
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Trigger runs hotkey Actions, then Task, when the system event On
+// happens. SSID narrows "ssid" to one network, Device narrows device
+// events to a USB VID:PID such as "0781:5583" or a volume label. "idle"
+// fires after After seconds without input, with a notification Warn
+// seconds before (default 60) that input cancels. "file_changed" watches
+// Paths, globs or directories relative to the config dir, and fires once
+// changes settle for Debounce (default 1s).
+type Trigger struct {
+	On       string   `json:"on"`
+	Task     string   `json:"task,omitempty"`
+	Actions  []string `json:"actions,omitempty"`
+	SSID     string   `json:"ssid,omitempty"`
+	Device   string   `json:"device,omitempty"`
+	After    int      `json:"after,omitempty"`
+	Warn     *int     `json:"warn,omitempty"`
+	Paths    []string `json:"paths,omitempty"`
+	Debounce string   `json:"debounce,omitempty"`
+}
+
+var (
+	triggerEvents = map[string]bool{
+		"lock":    true,
+		"unlock":  true,
+		"sleep":   true,
+		"wake":    true,
+		"network": true,
+		"ssid":    true,
+
+		"device_added":   true,
+		"device_removed": true,
+
+		"ac":      true,
+		"battery": true,
+		"idle":    true,
+
+		"file_changed": true,
+	}
+
+	triggerMutex sync.Mutex
+)
+
+func checkTriggers(cfg *Config) error {
+	actions := hotKeyActions()
+	for i, t := range cfg.Triggers {
+		if !triggerEvents[t.On] {
+			return fmt.Errorf("trigger %d: unknown event %q", i+1, t.On)
+		}
+		if t.On == "ssid" && t.SSID == "" {
+			return errors.New("trigger ssid: needs an ssid")
+		}
+		if strings.HasPrefix(t.On, "device_") && t.Device == "" {
+			return fmt.Errorf("trigger %s: needs a device", t.On)
+		}
+		if t.On == "idle" && t.After <= 0 {
+			return errors.New("trigger idle: needs after, in seconds")
+		}
+		if t.On == "file_changed" && len(t.Paths) == 0 {
+			return errors.New("trigger file_changed: needs paths")
+		}
+		if _, err := parseDuration(t.Debounce); t.Debounce != "" && err != nil {
+			return fmt.Errorf("trigger %s: bad debounce, %s", t.On, err)
+		}
+		if t.Task == "" && len(t.Actions) == 0 {
+			return fmt.Errorf("trigger %s: needs a task or actions", t.On)
+		}
+		if _, ok := cfg.Tasks[t.Task]; t.Task != "" && !ok {
+			return fmt.Errorf("trigger %s: unknown task %s", t.On, t.Task)
+		}
+		for _, name := range t.Actions {
+			if _, ok := actions[name]; !ok {
+				return fmt.Errorf("trigger %s: unknown action %s", t.On, name)
+			}
+		}
+	}
+	return nil
+}
+
+func hasTrigger(event string) bool {
+	for _, t := range config().Triggers {
+		if t.On == event {
+			return true
+		}
+	}
+	return false
+}
+
+// startTriggers watches the system events that triggers listen for.
+func startTriggers() error {
+	if len(config().Triggers) == 0 {
+		return nil
+	}
+
+	err := watchSystemEvents()
+	if err != nil {
+		logError("ERR: system events, %s", err)
+		return err
+	}
+	if hasTrigger("network") || hasTrigger("ssid") {
+		go watchNetwork()
+	}
+	if hasTrigger("device_added") || hasTrigger("device_removed") {
+		devices, err := listDevices()
+		if err != nil {
+			logError("ERR: devices, %s", err)
+			return err
+		}
+		go watchDevices(devices)
+	}
+	if hasTrigger("ac") || hasTrigger("battery") {
+		ac, err := onACPower()
+		if err != nil {
+			logError("ERR: power status, %s", err)
+			return err
+		}
+		go watchPower(ac)
+	}
+	if hasTrigger("idle") {
+		_, err := idleTime()
+		if err != nil {
+			logError("ERR: idle time, %s", err)
+			return err
+		}
+		go watchIdle()
+	}
+	for _, t := range config().Triggers {
+		if t.On == "file_changed" {
+			go watchFiles(t)
+		}
+	}
+	logInfo("[WATCHING SYSTEM EVENTS]")
+	return nil
+}
+
+// fireTrigger runs the triggers for event and returns when they are done.
+func fireTrigger(event, subject string) {
+	var matched []Trigger
+	for _, t := range config().Triggers {
+		if t.matches(event, subject) {
+			matched = append(matched, t)
+		}
+	}
+	runTriggers(event, subject, matched)
+}
+
+// runTriggers handles events one at a time, so lock and unlock can't
+// interleave.
+func runTriggers(event, subject string, triggers []Trigger) {
+	if len(triggers) == 0 {
+		return
+	}
+
+	triggerMutex.Lock()
+	defer triggerMutex.Unlock()
+
+	logInfo("")
+	if subject != "" {
+		logInfo("[SYSTEM EVENT %s %s]", event, subject)
+	} else {
+		logInfo("[SYSTEM EVENT %s]", event)
+	}
+	publishEvent(Event{Type: "system", Name: event, Text: subject})
+
+	actions := hotKeyActions()
+	for _, t := range triggers {
+		for _, name := range t.Actions {
+			actions[name]()
+		}
+		if t.Task != "" {
+			runTask(t.Task)
+		}
+	}
+}
+
+func (t Trigger) matches(event, subject string) bool {
+	if t.On != event {
+		return false
+	}
+	switch event {
+	case "ssid":
+		return t.SSID == subject
+	case "device_added", "device_removed":
+		return strings.EqualFold(t.Device, subject)
+	}
+	return true
+}
+
+// watchNetwork polls the Wi-Fi name and default gateway, which together
+// tell one network from another.
+func watchNetwork() {
+	ssid, gateway := currentSSID(), defaultGateway()
+	for range time.Tick(5 * time.Second) {
+		nowSSID, nowGateway := currentSSID(), defaultGateway()
+		if nowSSID == ssid && nowGateway == gateway {
+			continue
+		}
+
+		changedSSID := nowSSID != ssid
+		ssid, gateway = nowSSID, nowGateway
+		fireTrigger("network", ssid)
+		if changedSSID && ssid != "" {
+			fireTrigger("ssid", ssid)
+		}
+	}
+}
+
+func watchDevices(devices map[string]bool) {
+	for range time.Tick(3 * time.Second) {
+		now, err := listDevices()
+		if err != nil {
+			continue
+		}
+
+		for id := range now {
+			if !devices[id] {
+				fireTrigger("device_added", id)
+			}
+		}
+		for id := range devices {
+			if !now[id] {
+				fireTrigger("device_removed", id)
+			}
+		}
+		devices = now
+	}
+}
+
+func watchPower(ac bool) {
+	for range time.Tick(5 * time.Second) {
+		now, err := onACPower()
+		if err != nil || now == ac {
+			continue
+		}
+
+		ac = now
+		if ac {
+			fireTrigger("ac", "")
+		} else {
+			fireTrigger("battery", "")
+		}
+	}
+}
+
+func (t Trigger) warnBefore() time.Duration {
+	if t.Warn != nil {
+		return time.Duration(*t.Warn) * time.Second
+	}
+	return time.Minute
+}
+
+func (t Trigger) describe() string {
+	parts := append([]string(nil), t.Actions...)
+	if t.Task != "" {
+		parts = append(parts, "task "+t.Task)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// watchIdle warns, then fires, each idle trigger once per idle period.
+// Any input resets the idle time, which cancels a pending warning.
+func watchIdle() {
+	warned := make([]bool, len(config().Triggers))
+	fired := make([]bool, len(config().Triggers))
+	var last time.Duration
+	for range time.Tick(5 * time.Second) {
+		idle, err := idleTime()
+		if err != nil {
+			continue
+		}
+		active := idle < last
+		last = idle
+
+		for i, t := range config().Triggers {
+			if i >= len(fired) || t.On != "idle" {
+				continue
+			}
+
+			if active {
+				if warned[i] && !fired[i] {
+					logInfo("idle canceled: %s", t.describe())
+				}
+				warned[i], fired[i] = false, false
+			}
+
+			after := time.Duration(t.After) * time.Second
+			switch {
+			case fired[i]:
+			case idle >= after:
+				fired[i] = true
+				runTriggers("idle", "", []Trigger{t})
+			case idle >= after-t.warnBefore() && !warned[i]:
+				warned[i] = true
+				left := (after - idle).Round(time.Second)
+				logInfo("idle warning: %s in %s", t.describe(), left)
+				sendNotification("safework: idle", fmt.Sprintf("%s in %s, move the mouse to cancel", t.describe(), left))
+			}
+		}
+	}
+}
+
+// watchFiles polls modification times and sizes under t.Paths.
+func watchFiles(t Trigger) {
+	debounce := time.Second
+	if t.Debounce != "" {
+		debounce, _ = parseDuration(t.Debounce)
+	}
+
+	files := scanFiles(t.Paths)
+	var changed string
+	var lastChange time.Time
+	for range time.Tick(time.Second / 2) {
+		now := scanFiles(t.Paths)
+		for name, stamp := range now {
+			if files[name] != stamp {
+				changed, lastChange = name, time.Now()
+			}
+		}
+		for name := range files {
+			if _, ok := now[name]; !ok {
+				changed, lastChange = name, time.Now()
+			}
+		}
+		files = now
+
+		if changed != "" && time.Since(lastChange) >= debounce {
+			runTriggers("file_changed", changed, []Trigger{t})
+			changed = ""
+		}
+	}
+}
+
+func scanFiles(paths []string) map[string]string {
+	files := map[string]string{}
+	for _, p := range paths {
+		p = os.ExpandEnv(p)
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(configDir, p)
+		}
+
+		matches, _ := filepath.Glob(p)
+		for _, match := range matches {
+			filepath.Walk(match, func(name string, fi os.FileInfo, err error) error {
+				if err == nil && !fi.IsDir() {
+					files[name] = fmt.Sprintf("%d %d", fi.ModTime().UnixNano(), fi.Size())
+				}
+				return nil
+			})
+		}
+	}
+	return files
+}
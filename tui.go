@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type tuiState struct {
+	dir      string
+	status   *instanceStatus
+	err      error
+	selected int
+	showLogs bool
+	message  string
+	frame    int
+}
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// runTUI shows a running instance full screen: its startup steps as they
+// run, the background processes and the log of the selected one.
+func runTUI(args []string) int {
+	_, dir, ok := splitDirArg(args, 0, "tui [config dir]")
+	if !ok {
+		return 2
+	}
+	if _, err := ipcCall(dir, "ping"); err != nil {
+		fmt.Printf("ERR: %s\n", err)
+		return 1
+	}
+	// for the log paths only
+	logsErr := loadConfig(dir)
+
+	restore, err := makeRaw(os.Stdin)
+	if err != nil {
+		fmt.Printf("ERR: tui needs a terminal, %s\n", err)
+		return 1
+	}
+	defer restore()
+	colorOutput = !flagNoColor && os.Getenv("NO_COLOR") == "" && enableColor(os.Stdout)
+
+	// alternate screen, hidden cursor
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan string)
+	go readKeys(os.Stdin, keys)
+	results := make(chan string, 1)
+	tick := time.NewTicker(250 * time.Millisecond)
+	defer tick.Stop()
+
+	s := &tuiState{dir: dir}
+	s.refresh()
+	for {
+		s.draw(logsErr)
+
+		select {
+		case <-tick.C:
+			s.frame++
+			s.refresh()
+		case msg := <-results:
+			s.message = msg
+		case key, ok := <-keys:
+			if !ok || key == "q" || key == "ctrl+c" {
+				return 0
+			}
+			s.handleKey(key, results)
+		}
+	}
+}
+
+func (s *tuiState) refresh() {
+	b, err := ipcCall(s.dir, "status")
+	if err != nil {
+		s.status, s.err = nil, err
+		return
+	}
+	var status instanceStatus
+	s.err = json.Unmarshal(b, &status)
+	s.status = &status
+	if s.selected >= len(status.Processes) {
+		s.selected = len(status.Processes) - 1
+	}
+	if s.selected < 0 {
+		s.selected = 0
+	}
+}
+
+func (s *tuiState) selectedProcess() *processStatus {
+	if s.status == nil || s.selected >= len(s.status.Processes) {
+		return nil
+	}
+	return &s.status.Processes[s.selected]
+}
+
+func (s *tuiState) handleKey(key string, results chan<- string) {
+	switch key {
+	case "up", "k":
+		if s.selected > 0 {
+			s.selected--
+		}
+	case "down", "j":
+		if s.status != nil && s.selected < len(s.status.Processes)-1 {
+			s.selected++
+		}
+	case "l":
+		s.showLogs = !s.showLogs
+	case "r":
+		p := s.selectedProcess()
+		if p == nil {
+			return
+		}
+		if !p.Restartable {
+			s.message = fmt.Sprintf("%s was not started by safework", p.Name)
+			return
+		}
+		s.message = fmt.Sprintf("restarting %s ...", p.Name)
+		go func(name string, pid int) {
+			_, err := ipcCall(s.dir, "restart", strconv.Itoa(pid))
+			if err != nil {
+				results <- fmt.Sprintf("restart %s: %s", name, err)
+			} else {
+				results <- fmt.Sprintf("restarted %s", name)
+			}
+		}(p.Name, p.Pid)
+	case "c":
+		_, err := ipcCall(s.dir, "stop")
+		if err != nil {
+			s.message = fmt.Sprintf("cleanup: %s", err)
+		} else {
+			s.message = "cleanup started"
+		}
+	}
+}
+
+func (s *tuiState) draw(logsErr error) {
+	width, height := terminalSize(os.Stdout)
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	add("safework %s", s.dir)
+	add("")
+	switch {
+	case s.err != nil:
+		add("%s", s.err)
+	case s.status.Startup == nil:
+		add("STARTUP  not run")
+	default:
+		s.drawReport(add, *s.status.Startup)
+	}
+
+	if s.status != nil {
+		for _, name := range sortedReportNames(s.status.Tasks) {
+			add("")
+			s.drawReport(add, s.status.Tasks[name])
+		}
+
+		add("")
+		add("PROCESSES")
+		if len(s.status.Processes) == 0 {
+			add("  none")
+		}
+		for i, p := range s.status.Processes {
+			state := "dead"
+			if p.Alive {
+				state = "alive"
+			}
+			line := fmt.Sprintf("  %-20s %7d  %-8s %5.1f%%  %9s  %d restarts", p.Name, p.Pid, state, p.CPU, formatBytes(p.Memory), p.Restarts)
+			if i == s.selected {
+				line = "\x1b[7m>" + line[1:] + "\x1b[0m"
+			}
+			add("%s", line)
+		}
+	}
+
+	if p := s.selectedProcess(); s.showLogs && p != nil {
+		add("")
+		add("LOG %s", p.Name)
+		n := height - len(lines) - 3
+		if logsErr != nil {
+			add("  %s", logsErr)
+		} else if n > 0 {
+			tail, err := tailLines(processLogPath(p.Name), n)
+			if err != nil {
+				add("  %s", err)
+			}
+			for _, line := range tail {
+				add("  %s", line)
+			}
+		}
+	}
+
+	// keep the footer on the last line
+	for len(lines) < height-2 {
+		lines = append(lines, "")
+	}
+	add("%s", s.message)
+	add("up/down select  r restart  l logs  c cleanup  q quit")
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i, line := range lines {
+		if i >= height {
+			break
+		}
+		b.WriteString(fitWidth(line, width))
+		b.WriteString("\x1b[K")
+		if i < len(lines)-1 && i < height-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	b.WriteString("\x1b[J")
+	os.Stdout.WriteString(b.String())
+}
+
+func (s *tuiState) drawReport(add func(string, ...interface{}), r reportStatus) {
+	add("%s  %s  %s", r.Title, colorStatus(r.Status), r.Duration)
+	for _, step := range r.Steps {
+		mark := " "
+		if step.Status == "running" {
+			mark = spinnerFrames[s.frame%len(spinnerFrames)]
+		}
+		pad := strings.Repeat(" ", 8-len(step.Status))
+		add("  %s %-24s %s%s %9s  %s", mark, step.Name, colorStatus(step.Status), pad, step.Duration, step.Error)
+	}
+}
+
+func sortedReportNames(reports map[string]reportStatus) []string {
+	names := make([]string, 0, len(reports))
+	for name := range reports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fitWidth cuts a line to the terminal width, dropping its colors if it
+// has to be cut.
+func fitWidth(line string, width int) string {
+	plain := []rune(ansiRegex.ReplaceAllString(line, ""))
+	if len(plain) <= width {
+		return line
+	}
+	return string(plain[:width])
+}
+
+// tailLines returns the last n lines of a file, reading at most its last
+// 64 KB.
+func tailLines(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := fi.Size() - 64<<10
+	if offset < 0 {
+		offset = 0
+	}
+	f.Seek(offset, io.SeekStart)
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(string(b), "\r", ""), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// readKeys turns terminal input into key names, with arrow keys as "up"
+// and "down".
+func readKeys(r io.Reader, keys chan<- string) {
+	defer close(keys)
+	buf := make([]byte, 16)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		in := string(buf[:n])
+		switch {
+		case in == "\x03":
+			keys <- "ctrl+c"
+		case in == "\x1b[A" || in == "\x1bOA":
+			keys <- "up"
+		case in == "\x1b[B" || in == "\x1bOB":
+			keys <- "down"
+		case strings.HasPrefix(in, "\x1b"):
+			// other escape sequences
+		default:
+			for _, c := range in {
+				keys <- strings.ToLower(string(c))
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func processUsage(pid int) (resourceUsage, error) {
+	var u resourceUsage
+	out, err := exec.Command("ps", "-o", "rss=,time=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return u, err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return u, errors.New("unexpected ps output")
+	}
+
+	kb, _ := strconv.ParseUint(fields[0], 10, 64)
+	u.Memory = kb << 10
+
+	// [[dd-]hh:]mm:ss.cc
+	var secs float64
+	for _, part := range strings.Split(fields[1], ":") {
+		v, _ := strconv.ParseFloat(part, 64)
+		secs = secs*60 + v
+	}
+	u.CPUTime = time.Duration(secs * float64(time.Second))
+
+	out, err = exec.Command("lsof", "-n", "-P", "-F", "f", "-p", strconv.Itoa(pid)).Output()
+	if err == nil {
+		u.Handles = bytes.Count(out, []byte("\nf"))
+	}
+	return u, nil
+}
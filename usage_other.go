@@ -0,0 +1,41 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is USER_HZ, which is 100 on every Linux in use.
+const clockTicks = 100
+
+func processUsage(pid int) (resourceUsage, error) {
+	var u resourceUsage
+	b, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return u, err
+	}
+
+	// the command name may hold spaces, the fields after it don't
+	s := string(b)
+	fields := strings.Fields(s[strings.LastIndexByte(s, ')')+1:])
+	if len(fields) < 22 {
+		return u, fmt.Errorf("bad /proc/%d/stat", pid)
+	}
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	rss, _ := strconv.ParseInt(fields[21], 10, 64)
+	u.CPUTime = time.Duration(utime+stime) * time.Second / clockTicks
+	u.Memory = uint64(rss) * uint64(os.Getpagesize())
+
+	fds, err := ioutil.ReadDir(fmt.Sprintf("/proc/%d/fd", pid))
+	if err == nil {
+		u.Handles = len(fds)
+	}
+	return u, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const processQueryInformation = 0x0400
+
+var (
+	procK32GetProcessMemoryInfo = kernel32.NewProc("K32GetProcessMemoryInfo")
+	procGetProcessHandleCount   = kernel32.NewProc("GetProcessHandleCount")
+)
+
+type processMemoryCounters struct {
+	Size                       uint32
+	PageFaultCount             uint32
+	PeakWorkingSetSize         uintptr
+	WorkingSetSize             uintptr
+	QuotaPeakPagedPoolUsage    uintptr
+	QuotaPagedPoolUsage        uintptr
+	QuotaPeakNonPagedPoolUsage uintptr
+	QuotaNonPagedPoolUsage     uintptr
+	PagefileUsage              uintptr
+	PeakPagefileUsage          uintptr
+}
+
+func processUsage(pid int) (resourceUsage, error) {
+	var u resourceUsage
+	h, err := syscall.OpenProcess(processQueryInformation, false, uint32(pid))
+	if err != nil {
+		h, err = syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	}
+	if err != nil {
+		return u, err
+	}
+	defer syscall.CloseHandle(h)
+
+	var created, exited, kernel, user syscall.Filetime
+	err = syscall.GetProcessTimes(h, &created, &exited, &kernel, &user)
+	if err != nil {
+		return u, err
+	}
+	u.CPUTime = filetimeDuration(kernel) + filetimeDuration(user)
+
+	var mem processMemoryCounters
+	mem.Size = uint32(unsafe.Sizeof(mem))
+	ret, _, _ := procK32GetProcessMemoryInfo.Call(uintptr(h), uintptr(unsafe.Pointer(&mem)), uintptr(mem.Size))
+	if ret != 0 {
+		u.Memory = uint64(mem.WorkingSetSize)
+	}
+
+	var count uint32
+	ret, _, _ = procGetProcessHandleCount.Call(uintptr(h), uintptr(unsafe.Pointer(&count)))
+	if ret != 0 {
+		u.Handles = int(count)
+	}
+	return u, nil
+}
+
+// filetimeDuration reads an interval, not a date, so Nanoseconds with its
+// epoch offset doesn't apply.
+func filetimeDuration(ft syscall.Filetime) time.Duration {
+	return time.Duration(int64(ft.HighDateTime)<<32|int64(ft.LowDateTime)) * 100
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// checkCommands validates every command list in the config before
+// anything runs, naming the list, index and name of a bad entry.
+func checkCommands(cfg *Config) error {
+	if cfg.StartupTimeout < 0 {
+		return errors.New("negative startup_timeout")
+	}
+
+	lists := map[string][]CommandLine{
+		"startup": cfg.Startup,
+		"cleanup": cfg.Cleanup,
+	}
+	for i, stage := range cfg.Stages {
+		lists[fmt.Sprintf("stages[%d] %s", i, stage.Name)] = stage.Commands
+	}
+	for name, steps := range cfg.Tasks {
+		lists["task "+name] = steps
+	}
+	for name, steps := range cfg.Macros {
+		lists["macro "+name] = steps
+	}
+
+	names := make([]string, 0, len(lists))
+	for name := range lists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, where := range names {
+		err := checkCommandList(cfg, where, lists[where])
+		if err != nil {
+			return err
+		}
+	}
+	for name, tpl := range cfg.Templates {
+		err := checkCommand(cfg, tpl)
+		if err != nil {
+			return fmt.Errorf("template %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func checkCommandList(cfg *Config, where string, commands []CommandLine) error {
+	for i, cli := range commands {
+		label := fmt.Sprintf("%s[%d]", where, i)
+		if name := commandName(cli); name != "" {
+			label += " " + name
+		}
+
+		err := checkCommand(cfg, cli)
+		if err != nil {
+			return fmt.Errorf("%s: %s", label, err)
+		}
+		err = checkCommandList(cfg, label+" on_failure", cli.OnFailure)
+		if err == nil {
+			err = checkCommandList(cfg, label+" teardown", cli.Teardown)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkCommand(cfg *Config, cli CommandLine) error {
+	if cli.Template != "" {
+		if _, ok := cfg.Templates[cli.Template]; !ok {
+			return fmt.Errorf("unknown template %s", cli.Template)
+		}
+	} else if strings.TrimSpace(cli.Command) == "" {
+		return errors.New("empty command")
+	}
+
+	switch {
+	case cli.Timeout < 0:
+		return errors.New("negative timeout")
+	case cli.StopTimeout < 0:
+		return errors.New("negative stop_timeout")
+	case cli.RestartWindow < 0:
+		return errors.New("negative restart_window")
+	case cli.MaxRestarts < 0:
+		return errors.New("negative max_restarts")
+	}
+	switch cli.Restart {
+	case "", "no", "on-failure", "always":
+	default:
+		return fmt.Errorf("bad restart policy %q, use no, on-failure or always", cli.Restart)
+	}
+
+	if !isMacro(cli) {
+		return nil
+	}
+	name := strings.ToUpper(cli.Command)
+	spec, ok := builtinMacros[name]
+	if !ok {
+		if _, ok := cfg.Macros[name]; !ok && !strings.ContainsAny(name, "${") {
+			return fmt.Errorf("unknown macro %s", cli.Command)
+		}
+		return nil
+	}
+
+	// values filled in at run time are checked then, but still count
+	var args []string
+	for _, arg := range cli.Args {
+		if !strings.ContainsAny(arg, "${") {
+			args = append(args, arg)
+		}
+	}
+	later := len(cli.Args) - len(args)
+	cli.Args = args
+	cli, err := parseMacroArgs(cli, spec.params)
+	if err != nil {
+		return err
+	}
+	if macroArgCount(cli)+later < spec.minArgs {
+		return fmt.Errorf("missing arguments, needs %d", spec.minArgs)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckCommandMinArgs(t *testing.T) {
+	tests := []struct {
+		cli CommandLine
+		ok  bool
+	}{
+		{CommandLine{Command: "!WAIT_DB"}, false},
+		{CommandLine{Command: "!WAIT_DB", Args: []string{"timeout=5s"}}, false},
+		{CommandLine{Command: "!WAIT_DB", Args: []string{"postgres://localhost/db"}}, true},
+		{CommandLine{Command: "!KILL_PROCESS"}, false},
+		{CommandLine{Command: "!KILL_PROCESS", Args: []string{"mode=force"}}, false},
+		{CommandLine{Command: "!KILL_PROCESS", Args: []string{"node"}}, true},
+		{CommandLine{Command: "!WAIT_URL_CONTENT", Args: []string{"http://localhost"}}, false},
+		{CommandLine{Command: "!WAIT_URL_CONTENT", Args: []string{"url=http://localhost", "status==ok"}}, true},
+		{CommandLine{Command: "!COPY", Args: []string{"a.txt"}}, false},
+		{CommandLine{Command: "!COPY", Args: []string{"a.txt", "${DEST}"}}, true},
+		{CommandLine{Command: "!SLEEP", Args: []string{"duration=1s"}}, true},
+		{CommandLine{Command: "!SAVE_LAYOUT"}, true},
+	}
+
+	for _, tt := range tests {
+		err := checkCommand(&Config{}, tt.cli)
+		if tt.ok && err != nil {
+			t.Errorf("%s %q: %s", tt.cli.Command, tt.cli.Args, err)
+		}
+		if !tt.ok && (err == nil || !strings.Contains(err.Error(), "missing arguments")) {
+			t.Errorf("%s %q: got %v, want missing arguments", tt.cli.Command, tt.cli.Args, err)
+		}
+	}
+}
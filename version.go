@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// set at build time, for example
+// go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildDate=$(date -u +%Y-%m-%d)"
+var (
+	version   = "dev"
+	commit    string
+	buildDate string
+)
+
+// configSchema is the newest commands.json schema this build reads. A
+// config declares the one it needs with "schema".
+const configSchema = 1
+
+// buildInfo fills in the commit and date from the module build info when
+// they were not set by ldflags.
+func buildInfo() (string, string) {
+	rev, date := commit, buildDate
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && rev == "":
+				rev = s.Value
+				if len(rev) > 12 {
+					rev = rev[:12]
+				}
+			case s.Key == "vcs.time" && date == "":
+				date = s.Value
+			}
+		}
+	}
+	if rev == "" {
+		rev = "unknown"
+	}
+	if date == "" {
+		date = "unknown"
+	}
+	return rev, date
+}
+
+func runVersionCommand(args []string) int {
+	if len(args) > 0 {
+		fmt.Println("usage: safework version")
+		return 2
+	}
+
+	rev, date := buildInfo()
+	fmt.Printf("safework %s\n", version)
+	fmt.Printf("commit:        %s\n", rev)
+	fmt.Printf("built:         %s\n", date)
+	fmt.Printf("platform:      %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Printf("go:            %s\n", runtime.Version())
+	fmt.Printf("config schema: %d\n", configSchema)
+	return 0
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Webhook runs Task when a POST to /webhooks/<name> matches. Event is
+// compared with the X-GitHub-Event or X-Gitlab-Event header, and Match
+// maps dotted payload paths to the values they must equal.
+type Webhook struct {
+	Name   string                 `json:"name"`
+	Task   string                 `json:"task"`
+	Secret string                 `json:"secret,omitempty"`
+	Event  string                 `json:"event,omitempty"`
+	Match  map[string]interface{} `json:"match,omitempty"`
+}
+
+func findWebhook(name string) *Webhook {
+	for i := range config().Webhooks {
+		if config().Webhooks[i].Name == name {
+			return &config().Webhooks[i]
+		}
+	}
+	return nil
+}
+
+// checkSignature accepts GitHub's X-Hub-Signature-256 or GitLab's
+// X-Gitlab-Token.
+func (h *Webhook) checkSignature(r *http.Request, body []byte) error {
+	secret := os.ExpandEnv(h.Secret)
+
+	if sig := r.Header.Get("X-Hub-Signature-256"); sig != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		if hmac.Equal([]byte(sig), []byte(want)) {
+			return nil
+		}
+		return errors.New("bad signature")
+	}
+	if token := r.Header.Get("X-Gitlab-Token"); token != "" {
+		if hmac.Equal([]byte(token), []byte(secret)) {
+			return nil
+		}
+		return errors.New("bad token")
+	}
+	return errors.New("missing signature")
+}
+
+func (h *Webhook) matches(r *http.Request, payload interface{}) bool {
+	if h.Event != "" {
+		event := r.Header.Get("X-GitHub-Event")
+		if event == "" {
+			event = r.Header.Get("X-Gitlab-Event")
+		}
+		if !strings.EqualFold(event, h.Event) {
+			return false
+		}
+	}
+
+	for path, want := range h.Match {
+		got, ok := lookupJSON(payload, path)
+		if !ok || !reflect.DeepEqual(got, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// handleWebhook answers right away and runs the task in the background,
+// because CI senders time out within seconds.
+func handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/webhooks/"), "/")
+	hook := findWebhook(name)
+	if hook == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown webhook %s", name))
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 10<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if hook.Secret != "" {
+		err = hook.checkSignature(r, body)
+	} else if !controlTokenValid(r) {
+		err = errors.New("webhook without secret needs the control token")
+	}
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	var payload interface{}
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &payload)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if !hook.matches(r, payload) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ignored"})
+		return
+	}
+
+	logInfo("webhook %s: run task %s", hook.Name, hook.Task)
+	go runTask(hook.Task)
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted"})
+}
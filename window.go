@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+type (
+	WindowMatch struct {
+		Title   string `json:"title,omitempty"`
+		Process string `json:"process,omitempty"`
+	}
+
+	WindowPlacement struct {
+		Monitor  int  `json:"monitor,omitempty"`
+		X        int  `json:"x,omitempty"`
+		Y        int  `json:"y,omitempty"`
+		Width    int  `json:"width,omitempty"`
+		Height   int  `json:"height,omitempty"`
+		Maximize bool `json:"maximize,omitempty"`
+	}
+)
+
+func (m WindowMatch) matchTitle(title string) bool {
+	return m.Title == "" || strings.Contains(strings.ToLower(title), strings.ToLower(m.Title))
+}
+
+func (m WindowMatch) matchProcess(name string) bool {
+	if m.Process == "" {
+		return true
+	}
+	want := strings.TrimSuffix(strings.ToLower(m.Process), ".exe")
+	return strings.TrimSuffix(strings.ToLower(name), ".exe") == want
+}
+
+func (p *WindowPlacement) empty() bool {
+	return p.Width == 0 && p.Height == 0 && p.X == 0 && p.Y == 0 && p.Monitor == 0 && !p.Maximize
+}
+
+func runMacroFocusWindow(ctx context.Context, cli CommandLine) error {
+	match := WindowMatch{Title: cli.options["title"], Process: cli.options["process"]}
+	if match.Title == "" && match.Process == "" {
+		match.Title = strings.Join(cli.Args, " ")
+	}
+	if match.Title == "" && match.Process == "" {
+		return errors.New("!FOCUS_WINDOW requires title or process")
+	}
+
+	var place WindowPlacement
+	for key, dst := range map[string]*int{
+		"monitor": &place.Monitor,
+		"x":       &place.X,
+		"y":       &place.Y,
+		"width":   &place.Width,
+		"height":  &place.Height,
+	} {
+		if v, ok := cli.options[key]; ok {
+			*dst, _ = strconv.Atoi(v)
+		}
+	}
+	place.Maximize, _ = strconv.ParseBool(cli.options["maximize"])
+
+	return focusWindow(match, &place)
+}
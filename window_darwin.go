@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+)
+
+const focusScript = `on run argv
+	set appName to item 1 of argv
+	tell application appName to activate
+	if (count of argv) > 1 then
+		tell application "System Events" to tell process appName
+			set position of window 1 to {(item 2 of argv) as integer, (item 3 of argv) as integer}
+			if (item 4 of argv) as integer > 0 then
+				set size of window 1 to {(item 4 of argv) as integer, (item 5 of argv) as integer}
+			end if
+		end tell
+	end if
+end run`
+
+func focusWindow(match WindowMatch, place *WindowPlacement) error {
+	app := match.Process
+	if app == "" {
+		app = match.Title
+	}
+	if place.Monitor > 0 || place.Maximize {
+		return errors.New("monitor and maximize are not supported on macOS")
+	}
+
+	args := []string{"-e", focusScript, app}
+	if !place.empty() {
+		args = append(args, strconv.Itoa(place.X), strconv.Itoa(place.Y), strconv.Itoa(place.Width), strconv.Itoa(place.Height))
+	}
+	return runQuiet(exec.Command("osascript", args...))
+}
@@ -0,0 +1,47 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// wmctrl selects a window by title substring, or by WM_CLASS with -x.
+func wmctrl(match WindowMatch, action string, extra ...string) error {
+	var args []string
+	target := match.Title
+	if match.Process != "" {
+		args = append(args, "-x")
+		target = match.Process
+	}
+	args = append(args, action, target)
+	args = append(args, extra...)
+	return runQuiet(exec.Command("wmctrl", args...))
+}
+
+func focusWindow(match WindowMatch, place *WindowPlacement) error {
+	if place.Monitor > 0 {
+		return errors.New("monitor is not supported on linux, use x and y")
+	}
+
+	if !place.empty() {
+		w, h := place.Width, place.Height
+		if w == 0 || h == 0 {
+			w, h = -1, -1
+		}
+		err := wmctrl(match, "-r", "-e", fmt.Sprintf("0,%d,%d,%d,%d", place.X, place.Y, w, h))
+		if err != nil {
+			return err
+		}
+	}
+	if place.Maximize {
+		err := wmctrl(match, "-r", "-b", "add,maximized_vert,maximized_horz")
+		if err != nil {
+			return err
+		}
+	}
+
+	return wmctrl(match, "-a")
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	swHide     = 0
+	swMaximize = 3
+	swShow     = 5
+	swRestore  = 9
+	gwOwner    = 4
+
+	swpNoSize     = 0x0001
+	swpNoZOrder   = 0x0004
+	swpNoActivate = 0x0010
+
+	vkMenu         = 0x12
+	keyeventfKeyUp = 0x0002
+)
+
+var (
+	user32 = syscall.NewLazyDLL("user32.dll")
+
+	procEnumWindows              = user32.NewProc("EnumWindows")
+	procGetWindowTextW           = user32.NewProc("GetWindowTextW")
+	procGetWindowThreadProcessID = user32.NewProc("GetWindowThreadProcessId")
+	procIsWindowVisible          = user32.NewProc("IsWindowVisible")
+	procIsIconic                 = user32.NewProc("IsIconic")
+	procGetWindow                = user32.NewProc("GetWindow")
+	procShowWindow               = user32.NewProc("ShowWindow")
+	procSetForegroundWindow      = user32.NewProc("SetForegroundWindow")
+	procSetWindowPos             = user32.NewProc("SetWindowPos")
+	procGetWindowRect            = user32.NewProc("GetWindowRect")
+	procEnumDisplayMonitors      = user32.NewProc("EnumDisplayMonitors")
+	procGetMonitorInfoW          = user32.NewProc("GetMonitorInfoW")
+	procKeybdEvent               = user32.NewProc("keybd_event")
+
+	enumMutex       sync.Mutex
+	enumHandles     []uintptr
+	enumCallback    = syscall.NewCallback(collectHandle)
+	monitorCallback = syscall.NewCallback(collectMonitor)
+)
+
+type (
+	rect struct {
+		Left, Top, Right, Bottom int32
+	}
+
+	monitorInfo struct {
+		Size    uint32
+		Monitor rect
+		Work    rect
+		Flags   uint32
+	}
+
+	window struct {
+		hwnd    uintptr
+		pid     uint32
+		title   string
+		process string
+		visible bool
+	}
+)
+
+func collectHandle(hwnd, _ uintptr) uintptr {
+	enumHandles = append(enumHandles, hwnd)
+	return 1
+}
+
+func collectMonitor(hmon, _, _, _ uintptr) uintptr {
+	enumHandles = append(enumHandles, hmon)
+	return 1
+}
+
+func windowHandles() []uintptr {
+	enumMutex.Lock()
+	defer enumMutex.Unlock()
+
+	enumHandles = nil
+	procEnumWindows.Call(enumCallback, 0)
+	return enumHandles
+}
+
+// listWindows returns the top-level, unowned windows that have a title.
+func listWindows(includeHidden bool) []window {
+	names := processNames()
+
+	var wins []window
+	for _, hwnd := range windowHandles() {
+		if owner, _, _ := procGetWindow.Call(hwnd, gwOwner); owner != 0 {
+			continue
+		}
+		visible, _, _ := procIsWindowVisible.Call(hwnd)
+		if visible == 0 && !includeHidden {
+			continue
+		}
+
+		var buf [256]uint16
+		n, _, _ := procGetWindowTextW.Call(hwnd, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+		if n == 0 {
+			continue
+		}
+
+		var pid uint32
+		procGetWindowThreadProcessID.Call(hwnd, uintptr(unsafe.Pointer(&pid)))
+		wins = append(wins, window{
+			hwnd:    hwnd,
+			pid:     pid,
+			title:   syscall.UTF16ToString(buf[:n]),
+			process: names[pid],
+			visible: visible != 0,
+		})
+	}
+	return wins
+}
+
+func findWindows(match WindowMatch, includeHidden bool) []window {
+	var found []window
+	for _, w := range listWindows(includeHidden) {
+		if match.matchTitle(w.title) && match.matchProcess(w.process) {
+			found = append(found, w)
+		}
+	}
+	return found
+}
+
+func monitorRects() []rect {
+	enumMutex.Lock()
+	enumHandles = nil
+	procEnumDisplayMonitors.Call(0, 0, monitorCallback, 0)
+	handles := enumHandles
+	enumMutex.Unlock()
+
+	var rects []rect
+	for _, hmon := range handles {
+		info := monitorInfo{}
+		info.Size = uint32(unsafe.Sizeof(info))
+		procGetMonitorInfoW.Call(hmon, uintptr(unsafe.Pointer(&info)))
+		rects = append(rects, info.Work)
+	}
+	return rects
+}
+
+func placeWindow(hwnd uintptr, place *WindowPlacement) error {
+	if place.empty() {
+		return nil
+	}
+
+	var cur rect
+	procGetWindowRect.Call(hwnd, uintptr(unsafe.Pointer(&cur)))
+
+	x, y := int32(place.X), int32(place.Y)
+	if place.Monitor > 0 {
+		monitors := monitorRects()
+		if place.Monitor > len(monitors) {
+			return fmt.Errorf("monitor %d not found, %d connected", place.Monitor, len(monitors))
+		}
+		m := monitors[place.Monitor-1]
+		x += m.Left
+		y += m.Top
+	}
+
+	w, h := int32(place.Width), int32(place.Height)
+	if w == 0 || h == 0 {
+		w, h = cur.Right-cur.Left, cur.Bottom-cur.Top
+	}
+
+	procShowWindow.Call(hwnd, swRestore)
+	procSetWindowPos.Call(hwnd, 0, uintptr(x), uintptr(y), uintptr(w), uintptr(h), swpNoZOrder|swpNoActivate)
+	if place.Maximize {
+		procShowWindow.Call(hwnd, swMaximize)
+	}
+	return nil
+}
+
+func activateWindow(hwnd uintptr) {
+	if iconic, _, _ := procIsIconic.Call(hwnd); iconic != 0 {
+		procShowWindow.Call(hwnd, swRestore)
+	}
+
+	// windows only lets the foreground process change the foreground window,
+	// a synthetic ALT press lifts that restriction
+	procKeybdEvent.Call(vkMenu, 0, 0, 0)
+	procKeybdEvent.Call(vkMenu, 0, keyeventfKeyUp, 0)
+	procSetForegroundWindow.Call(hwnd)
+}
+
+func focusWindow(match WindowMatch, place *WindowPlacement) error {
+	wins := findWindows(match, false)
+	if len(wins) == 0 {
+		return errors.New("no window matches")
+	}
+
+	hwnd := wins[0].hwnd
+	err := placeWindow(hwnd, place)
+	if err != nil {
+		return err
+	}
+	activateWindow(hwnd)
+	return nil
+}